@@ -20,7 +20,7 @@ func NewNetProbeCommand() *cobra.Command {
 
 func main() {
 	rootCmd := NewNetProbeCommand()
-	rootCmd.AddCommand(ping.NewPingCommand(), dig.NewDigCommand())
+	rootCmd.AddCommand(ping.NewPingCommand(), ping.NewPMTUCommand(), dig.NewDigCommand())
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 
 	if err := rootCmd.Execute(); err != nil {
@@ -0,0 +1,8 @@
+//go:build armbe || arm64be || m68k || mips || mips64 || mips64p32 || ppc || ppc64 || s390 || s390x || shbe || sparc || sparc64
+
+package dialer
+
+import "encoding/binary"
+
+// hostByteOrder is the byte order of the machine.
+var hostByteOrder binary.ByteOrder = binary.BigEndian
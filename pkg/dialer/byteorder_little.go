@@ -0,0 +1,8 @@
+//go:build 386 || amd64 || amd64p32 || alpha || arm || arm64 || loong64 || mipsle || mips64le || mips64p32le || nios2 || ppc64le || riscv || riscv64 || sh || wasm
+
+package dialer
+
+import "encoding/binary"
+
+// hostByteOrder is the byte order of the machine.
+var hostByteOrder binary.ByteOrder = binary.LittleEndian
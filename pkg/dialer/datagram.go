@@ -0,0 +1,36 @@
+package dialer
+
+import "net"
+
+// DatagramDialer is a NetworkDialer whose ICMP packet connections use ICMP
+// datagram sockets (SOCK_DGRAM, IPPROTO_ICMP) instead of raw sockets. Unlike
+// raw sockets, these don't require root or CAP_NET_RAW, as long as the group
+// of the process is allowed by the net.ipv4.ping_group_range sysctl.
+//
+// Datagram sockets only carry the ICMP message: the IP header is neither
+// written nor received, the kernel sets the echo identifier to the local port
+// of the socket, and only echo replies (not ICMP errors) are received.
+type DatagramDialer struct {
+	Dialer
+}
+
+// datagramConn adapts an ICMP datagram socket, which the net package exposes
+// as a UDP socket, to the IP addresses used with raw sockets.
+type datagramConn struct {
+	*net.UDPConn
+}
+
+func (c *datagramConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if ipAddr, ok := addr.(*net.IPAddr); ok {
+		addr = &net.UDPAddr{IP: ipAddr.IP, Zone: ipAddr.Zone}
+	}
+	return c.UDPConn.WriteTo(b, addr)
+}
+
+func (c *datagramConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.UDPConn.ReadFrom(b)
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		addr = &net.IPAddr{IP: udpAddr.IP, Zone: udpAddr.Zone}
+	}
+	return n, addr, err
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package dialer
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// capNetRaw is the bit of the CAP_NET_RAW capability in capability sets
+const capNetRaw = 13
+
+// ListenPacket opens an ICMP datagram socket for the "ip4:icmp" and
+// "ip6:ipv6-icmp" networks, and behaves like Dialer.ListenPacket otherwise.
+func (d *DatagramDialer) ListenPacket(network, address string) (PacketConn, error) {
+	var family, proto int
+	switch network {
+	case "ip4:icmp", "ip4:1":
+		family, proto = syscall.AF_INET, syscall.IPPROTO_ICMP
+	case "ip6:ipv6-icmp", "ip6:58":
+		family, proto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+	default:
+		return d.Dialer.ListenPacket(network, address)
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, errors.Errorf("invalid listen address %s", address)
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, proto)
+	if err == syscall.EACCES {
+		return nil, errors.Wrapf(os.NewSyscallError("socket", err), "group %d is not allowed by net.ipv4.ping_group_range", os.Getegid())
+	}
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+
+	var sa syscall.Sockaddr
+	if family == syscall.AF_INET {
+		sa4 := &syscall.SockaddrInet4{}
+		copy(sa4.Addr[:], ip.To4())
+		sa = sa4
+	} else {
+		sa6 := &syscall.SockaddrInet6{}
+		copy(sa6.Addr[:], ip.To16())
+		sa = sa6
+	}
+	// binding assigns the socket a local port, which the kernel uses as the
+	// identifier of the echo requests sent on it
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	conn, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, err
+	}
+
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		conn.Close()
+		return nil, errors.Errorf("unexpected connection type %T", conn)
+	}
+	return &datagramConn{udpConn}, nil
+}
+
+// HasRawSocketCapability reports whether the process is allowed to open raw
+// sockets, i.e. whether it has CAP_NET_RAW in its effective capability set.
+func HasRawSocketCapability() bool {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return os.Geteuid() == 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "CapEff:")
+		if !found {
+			continue
+		}
+		capabilities, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			break
+		}
+		return capabilities&(1<<capNetRaw) != 0
+	}
+
+	return os.Geteuid() == 0
+}
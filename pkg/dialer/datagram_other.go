@@ -0,0 +1,25 @@
+//go:build !linux
+
+package dialer
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ListenPacket is only supported on Linux for ICMP networks, and behaves like
+// Dialer.ListenPacket otherwise.
+func (d *DatagramDialer) ListenPacket(network, address string) (PacketConn, error) {
+	switch network {
+	case "ip4:icmp", "ip4:1", "ip6:ipv6-icmp", "ip6:58":
+		return nil, errors.Errorf("ICMP datagram sockets are not supported on this platform")
+	}
+	return d.Dialer.ListenPacket(network, address)
+}
+
+// HasRawSocketCapability reports whether the process is allowed to open raw
+// sockets, which outside Linux requires running as root.
+func HasRawSocketCapability() bool {
+	return os.Geteuid() == 0
+}
@@ -1,6 +1,11 @@
 package dialer
 
-import "net"
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+)
 
 type Dialer struct{}
 
@@ -12,3 +17,28 @@ func (d *Dialer) Dial(network, address string) (net.Conn, error) {
 
 	return conn, nil
 }
+
+// DialContext is like Dial, but gives up on connecting once ctx is done.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var nd net.Dialer
+	conn, err := nd.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (d *Dialer) ListenPacket(network, address string) (PacketConn, error) {
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	packetConn, ok := conn.(PacketConn)
+	if !ok {
+		conn.Close()
+		return nil, errors.Errorf("network %s does not support packet connections", network)
+	}
+	return packetConn, nil
+}
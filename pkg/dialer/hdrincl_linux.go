@@ -0,0 +1,16 @@
+//go:build linux
+
+package dialer
+
+import (
+	"net"
+	"syscall"
+)
+
+// SetHeaderIncluded makes the kernel send the IPv4 header written on conn, a
+// raw socket, instead of building its own. The kernel still fills in the
+// checksum and total length, and the identification and source address when
+// they are left zero.
+func SetHeaderIncluded(conn net.Conn) error {
+	return setsockoptInt(conn, syscall.IPPROTO_IP, syscall.IP_HDRINCL, 1)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package dialer
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// SetHeaderIncluded is not supported on this platform. BSD kernels expect some
+// fields of the header in host byte order, which Serialize doesn't produce.
+func SetHeaderIncluded(conn net.Conn) error {
+	return errors.New("sending user built IPv4 headers is not supported on this platform")
+}
@@ -1,7 +1,20 @@
 package dialer
 
-import "net"
+import (
+	"context"
+	"net"
+)
 
 type NetworkDialer interface {
 	Dial(network, address string) (net.Conn, error)
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	ListenPacket(network, address string) (PacketConn, error)
+}
+
+// PacketConn is an unconnected packet-oriented connection. It can send
+// to any address with WriteTo, and also be read from with Read which,
+// unlike ReadFrom, returns raw IPv4 datagrams with their header intact.
+type PacketConn interface {
+	net.Conn
+	net.PacketConn
 }
@@ -0,0 +1,33 @@
+//go:build linux
+
+package dialer
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// SetIPOptions makes the kernel add options, already serialized and padded,
+// to the header of IPv4 packets sent on conn. Passing no options clears them.
+func SetIPOptions(conn net.Conn, options []byte) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return errors.Errorf("socket options are not supported by %T", conn)
+	}
+	rawConn, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockoptErr error
+	err = rawConn.Control(func(fd uintptr) {
+		sockoptErr = syscall.SetsockoptString(int(fd), syscall.IPPROTO_IP, syscall.IP_OPTIONS, string(options))
+	})
+	if err != nil {
+		return err
+	}
+	return os.NewSyscallError("setsockopt", sockoptErr)
+}
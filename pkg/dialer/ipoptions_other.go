@@ -0,0 +1,14 @@
+//go:build !linux
+
+package dialer
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// SetIPOptions is not supported on this platform.
+func SetIPOptions(conn net.Conn, options []byte) error {
+	return errors.New("setting IPv4 options is not supported on this platform")
+}
@@ -0,0 +1,36 @@
+package dialer
+
+import "encoding/binary"
+
+// RestoreIPv4Header returns b, a packet read from a raw IPv4 socket with Read,
+// with its header as it was sent on the wire.
+//
+// Unlike Linux, some BSD kernels hand the packets they deliver to raw sockets
+// over with the total length and the fragment offset in host byte order, the
+// header length being subtracted from the total length. Those fields are put
+// back in network byte order, which also makes the checksum match again. b is
+// returned as is on the other platforms.
+func RestoreIPv4Header(b []byte) []byte {
+	if hostOrder, withoutHeader := rawHeaderByteOrder(); hostOrder {
+		return restoreByteOrder(b, withoutHeader)
+	}
+	return b
+}
+
+// restoreByteOrder returns a copy of b, whose total length and fragment offset
+// are in host byte order, with those fields in network byte order. The header
+// length is added to the total length if withoutHeader is set.
+func restoreByteOrder(b []byte, withoutHeader bool) []byte {
+	if len(b) < 20 {
+		return b
+	}
+
+	b = append([]byte(nil), b...)
+	totalLength := hostByteOrder.Uint16(b[2:4])
+	if withoutHeader {
+		totalLength += uint16(b[0]&0x0f) * 4
+	}
+	binary.BigEndian.PutUint16(b[2:4], totalLength)
+	binary.BigEndian.PutUint16(b[6:8], hostByteOrder.Uint16(b[6:8]))
+	return b
+}
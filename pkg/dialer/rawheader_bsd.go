@@ -0,0 +1,10 @@
+//go:build darwin || dragonfly || netbsd
+
+package dialer
+
+// rawHeaderByteOrder tells whether raw sockets deliver the total length and
+// the fragment offset in host byte order, and whether the total length then
+// leaves out the header.
+func rawHeaderByteOrder() (hostOrder, withoutHeader bool) {
+	return true, true
+}
@@ -0,0 +1,16 @@
+package dialer
+
+import "syscall"
+
+// rawHeaderByteOrder tells whether raw sockets deliver the total length and
+// the fragment offset in host byte order, and whether the total length then
+// leaves out the header. FreeBSD delivers them in network byte order since
+// 11.0, and includes the header since 10.0.
+func rawHeaderByteOrder() (hostOrder, withoutHeader bool) {
+	version, err := syscall.SysctlUint32("kern.osreldate")
+	if err != nil {
+		// assume a recent kernel
+		return false, false
+	}
+	return version < 1100000, version < 1000000
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !dragonfly && !netbsd && !freebsd
+
+package dialer
+
+// rawHeaderByteOrder tells whether raw sockets deliver the total length and
+// the fragment offset in host byte order, which Linux doesn't.
+func rawHeaderByteOrder() (hostOrder, withoutHeader bool) {
+	return false, false
+}
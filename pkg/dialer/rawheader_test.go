@@ -0,0 +1,41 @@
+package dialer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echoRequest is an IPv4 packet carrying an ICMP echo request, with the
+// Don't Fragment flag set.
+var echoRequest = []byte{
+	0x45, 0x00, 0x00, 0x1c, 0x00, 0x01, 0x40, 0x00, 0x40, 0x01, 0xb6, 0xdc,
+	192, 0, 2, 1, 192, 0, 2, 2,
+	0x08, 0x00, 0xf7, 0xff, 0x00, 0x00, 0x00, 0x00,
+}
+
+func TestRestoreByteOrder(t *testing.T) {
+	// the header as handed over by a BSD kernel, the total length leaving
+	// out the header
+	b := append([]byte(nil), echoRequest...)
+	hostByteOrder.PutUint16(b[2:4], 8)
+	hostByteOrder.PutUint16(b[6:8], 0x4000)
+	assert.Equal(t, echoRequest, restoreByteOrder(b, true))
+
+	// FreeBSD 10 includes the header
+	hostByteOrder.PutUint16(b[2:4], 28)
+	assert.Equal(t, echoRequest, restoreByteOrder(b, false))
+
+	// the packet read isn't modified
+	assert.Equal(t, uint16(28), hostByteOrder.Uint16(b[2:4]))
+
+	// nor are packets too short to hold a header
+	assert.Equal(t, echoRequest[:12], restoreByteOrder(echoRequest[:12], true))
+}
+
+func TestRestoreIPv4Header(t *testing.T) {
+	if hostOrder, _ := rawHeaderByteOrder(); hostOrder {
+		t.Skip("raw sockets of this platform deliver some fields in host byte order")
+	}
+	assert.Equal(t, echoRequest, RestoreIPv4Header(echoRequest))
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package dialer
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// SetTTL is not supported on this platform.
+func SetTTL(conn net.Conn, ttl int) error {
+	return errors.New("setting the TTL is not supported on this platform")
+}
+
+// SetTOS is not supported on this platform.
+func SetTOS(conn net.Conn, tos int) error {
+	return errors.New("setting the type of service is not supported on this platform")
+}
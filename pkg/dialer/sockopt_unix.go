@@ -0,0 +1,63 @@
+//go:build unix
+
+package dialer
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// SetTTL sets the time to live of IPv4 packets, or the hop limit of IPv6
+// packets, sent on conn.
+func SetTTL(conn net.Conn, ttl int) error {
+	if isIPv6(conn) {
+		return setsockoptInt(conn, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl)
+	}
+	return setsockoptInt(conn, syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+}
+
+// SetTOS sets the type of service (DSCP and ECN bits) of IPv4 packets, or
+// the traffic class of IPv6 packets, sent on conn.
+func SetTOS(conn net.Conn, tos int) error {
+	if isIPv6(conn) {
+		return setsockoptInt(conn, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+	}
+	return setsockoptInt(conn, syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+}
+
+func setsockoptInt(conn net.Conn, level, name, value int) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return errors.Errorf("socket options are not supported by %T", conn)
+	}
+	rawConn, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockoptErr error
+	err = rawConn.Control(func(fd uintptr) {
+		sockoptErr = syscall.SetsockoptInt(int(fd), level, name, value)
+	})
+	if err != nil {
+		return err
+	}
+	return os.NewSyscallError("setsockopt", sockoptErr)
+}
+
+// isIPv6 reports whether conn is bound to an IPv6 address.
+func isIPv6(conn net.Conn) bool {
+	var ip net.IP
+	switch addr := conn.LocalAddr().(type) {
+	case *net.IPAddr:
+		ip = addr.IP
+	case *net.UDPAddr:
+		ip = addr.IP
+	case *net.TCPAddr:
+		ip = addr.IP
+	}
+	return ip != nil && ip.To4() == nil
+}
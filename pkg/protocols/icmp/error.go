@@ -0,0 +1,328 @@
+package icmp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+var (
+	unreachableCodes = map[uint8]string{
+		0:  "Destination Net Unreachable",
+		1:  "Destination Host Unreachable",
+		2:  "Destination Protocol Unreachable",
+		3:  "Destination Port Unreachable",
+		4:  "Frag needed and DF set",
+		5:  "Source Route Failed",
+		6:  "Destination Net Unknown",
+		7:  "Destination Host Unknown",
+		8:  "Source Host Isolated",
+		9:  "Destination Net Prohibited",
+		10: "Destination Host Prohibited",
+		11: "Destination Net Unreachable for Type of Service",
+		12: "Destination Host Unreachable for Type of Service",
+		13: "Packet filtered",
+		14: "Precedence Violation",
+		15: "Precedence Cutoff",
+	}
+
+	timeExceededCodes = map[uint8]string{
+		0: "Time to live exceeded",
+		1: "Frag reassembly time exceeded",
+	}
+
+	redirectCodes = map[uint8]string{
+		0: "Redirect Network",
+		1: "Redirect Host",
+		2: "Redirect Type of Service and Network",
+		3: "Redirect Type of Service and Host",
+	}
+
+	unreachableCodesV6 = map[uint8]string{
+		0: "No route",
+		1: "Administratively prohibited",
+		2: "Beyond scope of source address",
+		3: "Address unreachable",
+		4: "Port unreachable",
+		5: "Source address failed ingress/egress policy",
+		6: "Reject route to destination",
+	}
+
+	timeExceededCodesV6 = map[uint8]string{
+		0: "Hop limit exceeded in transit",
+		1: "Fragment reassembly time exceeded",
+	}
+
+	// ipv6HeaderSize is the size of the IPv6 header quoted by ICMPv6 error
+	// messages
+	ipv6HeaderSize = 40
+)
+
+// IsErrorMessage reports whether messages of type hType are ICMP error messages.
+func IsErrorMessage(hType uint8) bool {
+	switch hType {
+	case TypeDestinationUnreachable, TypeSourceQuench, TypeRedirect, TypeTimeExceeded, TypeParameterProblem:
+		return true
+	}
+	return false
+}
+
+// IsErrorMessageV6 reports whether messages of type hType are ICMPv6 error
+// messages that ParseErrorMessageV6 decodes.
+func IsErrorMessageV6(hType uint8) bool {
+	switch hType {
+	case TypeDestinationUnreachableV6, TypePacketTooBigV6, TypeTimeExceededV6:
+		return true
+	}
+	return false
+}
+
+// ParseErrorMessage decodes an ICMP error message, starting at its ICMP header.
+// The checksum is not verified.
+func ParseErrorMessage(b []byte) (*ErrorMessage, error) {
+	headerSize, ipHeaderMinSize := 8, 20
+	if len(b) < headerSize {
+		return nil, errors.Errorf("ICMP message too short: %d bytes", len(b))
+	}
+
+	m := &ErrorMessage{
+		Type: b[0],
+		Code: b[1],
+	}
+	if !IsErrorMessage(m.Type) {
+		return nil, errors.Errorf("ICMP type %d is not an error message", m.Type)
+	}
+
+	switch {
+	case m.Type == TypeRedirect:
+		m.Gateway = net.IP(append([]byte(nil), b[4:8]...))
+	case m.Type == TypeDestinationUnreachable && m.Code == CodeFragmentationNeeded:
+		m.NextHopMTU = binary.BigEndian.Uint16(b[6:8])
+	case m.Type == TypeParameterProblem:
+		m.Pointer = b[4]
+	}
+
+	// the quoted datagram starts with an IP header, whose length is
+	// given by the IHL field in 32 bit words
+	quoted := b[headerSize:]
+	if len(quoted) < ipHeaderMinSize {
+		return nil, errors.Errorf("quoted datagram too short: %d bytes", len(quoted))
+	}
+	ihl := int(quoted[0]&0x0f) * 4
+	if ihl < ipHeaderMinSize || len(quoted) < ihl+8 {
+		return nil, errors.Errorf("quoted datagram too short: %d bytes", len(quoted))
+	}
+
+	// Messages carrying RFC 4884 extensions give the length of the original
+	// datagram, in 32 bit words, which is padded to at least 128 bytes.
+	// Older messages leave it zero and quote as much as fits.
+	if originalLength := int(b[5]) * 4; originalLength > 0 && supportsExtensions(m.Type) {
+		if originalLength < ihl+8 || len(quoted) < originalLength {
+			return nil, errors.Errorf("invalid length of quoted datagram: %d bytes", originalLength)
+		}
+		extensions, err := parseExtensions(quoted[originalLength:])
+		if err != nil {
+			return nil, err
+		}
+		m.Extensions = extensions
+		quoted = quoted[:originalLength]
+	}
+
+	m.OriginalHeader = quoted[:ihl]
+	m.OriginalData = quoted[ihl:]
+
+	return m, nil
+}
+
+// ParseErrorMessageV6 decodes an ICMPv6 error message, starting at its ICMPv6
+// header. The checksum is not verified.
+func ParseErrorMessageV6(b []byte) (*ErrorMessage, error) {
+	headerSize := 8
+	if len(b) < headerSize {
+		return nil, errors.Errorf("ICMPv6 message too short: %d bytes", len(b))
+	}
+
+	m := &ErrorMessage{
+		Type: b[0],
+		Code: b[1],
+	}
+	if !IsErrorMessageV6(m.Type) {
+		return nil, errors.Errorf("ICMPv6 type %d is not an error message", m.Type)
+	}
+	if m.Type == TypePacketTooBigV6 {
+		mtu := binary.BigEndian.Uint32(b[4:8])
+		if mtu > 0xffff {
+			mtu = 0xffff
+		}
+		m.NextHopMTU = uint16(mtu)
+	}
+
+	// the quoted datagram starts with the fixed IPv6 header
+	quoted := b[headerSize:]
+	if len(quoted) < ipv6HeaderSize+8 {
+		return nil, errors.Errorf("quoted datagram too short: %d bytes", len(quoted))
+	}
+	if version := quoted[0] >> 4; version != 6 {
+		return nil, errors.Errorf("quoted datagram of IP version %d", version)
+	}
+
+	// Messages carrying RFC 4884 extensions give the length of the original
+	// datagram, in 64 bit words.
+	if originalLength := int(b[4]) * 8; originalLength > 0 && m.Type != TypePacketTooBigV6 {
+		if originalLength < ipv6HeaderSize+8 || len(quoted) < originalLength {
+			return nil, errors.Errorf("invalid length of quoted datagram: %d bytes", originalLength)
+		}
+		extensions, err := parseExtensions(quoted[originalLength:])
+		if err != nil {
+			return nil, err
+		}
+		m.Extensions = extensions
+		quoted = quoted[:originalLength]
+	}
+
+	m.OriginalHeader = quoted[:ipv6HeaderSize]
+	m.OriginalData = quoted[ipv6HeaderSize:]
+
+	return m, nil
+}
+
+// supportsExtensions reports whether messages of type hType may carry RFC 4884
+// extensions, in which case their sixth octet holds the length of the quoted
+// datagram.
+func supportsExtensions(hType uint8) bool {
+	switch hType {
+	case TypeDestinationUnreachable, TypeTimeExceeded, TypeParameterProblem:
+		return true
+	}
+	return false
+}
+
+// parseExtensions decodes the RFC 4884 extension structure that follows the
+// original datagram in an ICMP error message.
+func parseExtensions(b []byte) ([]ExtensionObject, error) {
+	headerSize, objectHeaderSize := 4, 4
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) < headerSize {
+		return nil, errors.Errorf("ICMP extension structure too short: %d bytes", len(b))
+	}
+	if version := b[0] >> 4; version != ExtensionVersion {
+		return nil, errors.Errorf("unsupported ICMP extension version %d", version)
+	}
+	// a zero checksum means that it wasn't computed
+	if binary.BigEndian.Uint16(b[2:4]) != 0 && protocols.CalculateChecksum(b) != 0 {
+		return nil, errors.New("invalid ICMP extension checksum")
+	}
+
+	var objects []ExtensionObject
+	for b = b[headerSize:]; len(b) > 0; {
+		if len(b) < objectHeaderSize {
+			return nil, errors.Errorf("truncated ICMP extension object: %d bytes", len(b))
+		}
+		length := int(binary.BigEndian.Uint16(b[0:2]))
+		if length < objectHeaderSize || length > len(b) {
+			return nil, errors.Errorf("invalid length of ICMP extension object: %d bytes", length)
+		}
+		objects = append(objects, ExtensionObject{
+			ClassNum: b[2],
+			CType:    b[3],
+			Data:     append([]byte(nil), b[objectHeaderSize:length]...),
+		})
+		b = b[length:]
+	}
+	return objects, nil
+}
+
+// isV6 reports whether m is an ICMPv6 error message, quoting an IPv6 header.
+func (m *ErrorMessage) isV6() bool {
+	return m.OriginalHeader[0]>>4 == 6
+}
+
+// OriginalProtocol returns the protocol number of the datagram that caused the
+// error, i.e. the Next Header field of IPv6 headers.
+func (m *ErrorMessage) OriginalProtocol() uint8 {
+	if m.isV6() {
+		return m.OriginalHeader[6]
+	}
+	return m.OriginalHeader[9]
+}
+
+// OriginalSource returns the source address of the datagram that caused the error.
+func (m *ErrorMessage) OriginalSource() net.IP {
+	if m.isV6() {
+		return net.IP(m.OriginalHeader[8:24])
+	}
+	return net.IP(m.OriginalHeader[12:16])
+}
+
+// OriginalDestination returns the destination address of the datagram that caused the error.
+func (m *ErrorMessage) OriginalDestination() net.IP {
+	if m.isV6() {
+		return net.IP(m.OriginalHeader[24:40])
+	}
+	return net.IP(m.OriginalHeader[16:20])
+}
+
+// IsPortUnreachable reports whether m tells that no process listens on the
+// destination port of the datagram.
+func (m *ErrorMessage) IsPortUnreachable() bool {
+	if m.isV6() {
+		return m.Type == TypeDestinationUnreachableV6 && m.Code == CodePortUnreachableV6
+	}
+	return m.Type == TypeDestinationUnreachable && m.Code == CodePortUnreachable
+}
+
+// String describes the message the way iputils ping does,
+// eg: "Destination Host Unreachable".
+func (m *ErrorMessage) String() string {
+	if m.isV6() {
+		return m.stringV6()
+	}
+
+	var codes map[uint8]string
+	switch m.Type {
+	case TypeDestinationUnreachable:
+		if m.Code == CodeFragmentationNeeded {
+			return fmt.Sprintf("%s (mtu = %d)", unreachableCodes[m.Code], m.NextHopMTU)
+		}
+		codes = unreachableCodes
+	case TypeTimeExceeded:
+		codes = timeExceededCodes
+	case TypeRedirect:
+		if description, ok := redirectCodes[m.Code]; ok {
+			return fmt.Sprintf("%s (New nexthop: %v)", description, m.Gateway)
+		}
+		codes = redirectCodes
+	case TypeSourceQuench:
+		return "Source Quench"
+	case TypeParameterProblem:
+		return fmt.Sprintf("Parameter problem: pointer = %d", m.Pointer)
+	}
+
+	if description, ok := codes[m.Code]; ok {
+		return description
+	}
+	return fmt.Sprintf("ICMP type %d, code %d", m.Type, m.Code)
+}
+
+// stringV6 describes an ICMPv6 error message the way iputils ping does,
+// eg: "Destination unreachable: Address unreachable".
+func (m *ErrorMessage) stringV6() string {
+	switch m.Type {
+	case TypeDestinationUnreachableV6:
+		if description, ok := unreachableCodesV6[m.Code]; ok {
+			return "Destination unreachable: " + description
+		}
+	case TypePacketTooBigV6:
+		return fmt.Sprintf("Packet too big: mtu=%d", m.NextHopMTU)
+	case TypeTimeExceededV6:
+		if description, ok := timeExceededCodesV6[m.Code]; ok {
+			return "Time exceeded: " + description
+		}
+	}
+	return fmt.Sprintf("ICMPv6 type %d, code %d", m.Type, m.Code)
+}
@@ -0,0 +1,158 @@
+package icmp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// the header of an IPv4 echo request from 192.0.2.1 to 192.0.2.2
+	quotedIPv4 = []byte{
+		0x45, 0x00, 0x00, 0x1c, 0x00, 0x01, 0x40, 0x00, 0x01, 0x01, 0x00, 0x00,
+		192, 0, 2, 1, 192, 0, 2, 2,
+	}
+	// the header of an IPv6 echo request from 2001:db8::1 to 2001:db8::2
+	quotedIPv6 = []byte{
+		0x60, 0x00, 0x00, 0x00, 0x00, 0x08, 58, 1,
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2,
+	}
+	quotedEchoRequest   = []byte{TypeEcho, 0, 0, 0, 0x12, 0x34, 0, 7}
+	quotedEchoRequestV6 = []byte{TypeEchoRequestV6, 0, 0, 0, 0x12, 0x34, 0, 7}
+)
+
+func cat(parts ...[]byte) []byte {
+	var b []byte
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+	return b
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message []byte
+		want    *ErrorMessage
+		str     string
+	}{
+		{
+			name:    "host unreachable",
+			message: cat([]byte{TypeDestinationUnreachable, 1, 0, 0, 0, 0, 0, 0}, quotedIPv4, quotedEchoRequest),
+			want:    &ErrorMessage{Type: TypeDestinationUnreachable, Code: 1, OriginalHeader: quotedIPv4, OriginalData: quotedEchoRequest},
+			str:     "Destination Host Unreachable",
+		},
+		{
+			name:    "fragmentation needed",
+			message: cat([]byte{TypeDestinationUnreachable, CodeFragmentationNeeded, 0, 0, 0, 0, 0x05, 0xdc}, quotedIPv4, quotedEchoRequest),
+			want:    &ErrorMessage{Type: TypeDestinationUnreachable, Code: CodeFragmentationNeeded, NextHopMTU: 1500, OriginalHeader: quotedIPv4, OriginalData: quotedEchoRequest},
+			str:     "Frag needed and DF set (mtu = 1500)",
+		},
+		{
+			name:    "time exceeded",
+			message: cat([]byte{TypeTimeExceeded, 0, 0, 0, 0, 0, 0, 0}, quotedIPv4, quotedEchoRequest),
+			want:    &ErrorMessage{Type: TypeTimeExceeded, OriginalHeader: quotedIPv4, OriginalData: quotedEchoRequest},
+			str:     "Time to live exceeded",
+		},
+		{
+			name:    "parameter problem",
+			message: cat([]byte{TypeParameterProblem, 0, 0, 0, 20, 0, 0, 0}, quotedIPv4, quotedEchoRequest),
+			want:    &ErrorMessage{Type: TypeParameterProblem, Pointer: 20, OriginalHeader: quotedIPv4, OriginalData: quotedEchoRequest},
+			str:     "Parameter problem: pointer = 20",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseErrorMessage(tt.message)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, m)
+			assert.Equal(t, tt.str, m.String())
+			assert.Equal(t, uint8(1), m.OriginalProtocol())
+			assert.True(t, m.OriginalSource().Equal(net.IP{192, 0, 2, 1}))
+			assert.True(t, m.OriginalDestination().Equal(net.IP{192, 0, 2, 2}))
+		})
+	}
+}
+
+func TestParseErrorMessageV6(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     []byte
+		want        *ErrorMessage
+		str         string
+		unreachable bool
+	}{
+		{
+			name:    "address unreachable",
+			message: cat([]byte{TypeDestinationUnreachableV6, 3, 0, 0, 0, 0, 0, 0}, quotedIPv6, quotedEchoRequestV6),
+			want:    &ErrorMessage{Type: TypeDestinationUnreachableV6, Code: 3, OriginalHeader: quotedIPv6, OriginalData: quotedEchoRequestV6},
+			str:     "Destination unreachable: Address unreachable",
+		},
+		{
+			name:        "port unreachable",
+			message:     cat([]byte{TypeDestinationUnreachableV6, CodePortUnreachableV6, 0, 0, 0, 0, 0, 0}, quotedIPv6, quotedEchoRequestV6),
+			want:        &ErrorMessage{Type: TypeDestinationUnreachableV6, Code: CodePortUnreachableV6, OriginalHeader: quotedIPv6, OriginalData: quotedEchoRequestV6},
+			str:         "Destination unreachable: Port unreachable",
+			unreachable: true,
+		},
+		{
+			name:    "packet too big",
+			message: cat([]byte{TypePacketTooBigV6, 0, 0, 0, 0, 0, 0x05, 0x00}, quotedIPv6, quotedEchoRequestV6),
+			want:    &ErrorMessage{Type: TypePacketTooBigV6, NextHopMTU: 1280, OriginalHeader: quotedIPv6, OriginalData: quotedEchoRequestV6},
+			str:     "Packet too big: mtu=1280",
+		},
+		{
+			name:    "jumbo packet too big",
+			message: cat([]byte{TypePacketTooBigV6, 0, 0, 0, 0, 1, 0, 0}, quotedIPv6, quotedEchoRequestV6),
+			want:    &ErrorMessage{Type: TypePacketTooBigV6, NextHopMTU: 0xffff, OriginalHeader: quotedIPv6, OriginalData: quotedEchoRequestV6},
+			str:     "Packet too big: mtu=65535",
+		},
+		{
+			name:    "hop limit exceeded",
+			message: cat([]byte{TypeTimeExceededV6, 0, 0, 0, 0, 0, 0, 0}, quotedIPv6, quotedEchoRequestV6),
+			want:    &ErrorMessage{Type: TypeTimeExceededV6, OriginalHeader: quotedIPv6, OriginalData: quotedEchoRequestV6},
+			str:     "Time exceeded: Hop limit exceeded in transit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseErrorMessageV6(tt.message)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, m)
+			assert.Equal(t, tt.str, m.String())
+			assert.Equal(t, tt.unreachable, m.IsPortUnreachable())
+			assert.Equal(t, ProtocolICMPv6, m.OriginalProtocol())
+			assert.True(t, m.OriginalSource().Equal(net.ParseIP("2001:db8::1")))
+			assert.True(t, m.OriginalDestination().Equal(net.ParseIP("2001:db8::2")))
+
+			p, err := ParseV6(tt.message, nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, p.Body)
+		})
+	}
+}
+
+func TestParseErrorMessageV6Malformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		message []byte
+	}{
+		{"truncated header", []byte{TypeTimeExceededV6, 0, 0, 0}},
+		{"not an error", cat([]byte{TypeEchoReplyV6, 0, 0, 0, 0, 0, 0, 0}, quotedIPv6, quotedEchoRequestV6)},
+		{"truncated quote", cat([]byte{TypeTimeExceededV6, 0, 0, 0, 0, 0, 0, 0}, quotedIPv6)},
+		{"quoted IPv4", cat([]byte{TypeTimeExceededV6, 0, 0, 0, 0, 0, 0, 0}, quotedIPv4, quotedIPv4, quotedEchoRequest)},
+		{"original length past the end", cat([]byte{TypeTimeExceededV6, 0, 0, 0, 16, 0, 0, 0}, quotedIPv6, quotedEchoRequestV6)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseErrorMessageV6(tt.message)
+			assert.Error(t, err)
+		})
+	}
+}
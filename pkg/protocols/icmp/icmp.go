@@ -1,8 +1,11 @@
 package icmp
 
 import (
+	"net"
+
 	"github.com/pkg/errors"
 	"github.com/swagnikdutta/netprobe/pkg/protocols"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/ipv6"
 )
 
 func CreatePacket(
@@ -37,3 +40,41 @@ func CreatePacket(
 
 	return p, packetSerialized, nil
 }
+
+// CreateV6Packet creates an ICMPv6 packet. Unlike ICMP, the ICMPv6 checksum
+// also covers an IPv6 pseudo-header, hence the source and destination addresses.
+func CreateV6Packet(
+	hType,
+	code uint8,
+	id,
+	seq uint16,
+	src,
+	dest net.IP,
+	data []byte,
+) (*Packet, []byte, error) {
+	p := &Packet{
+		Header: &Header{
+			Type:           hType,
+			Code:           code,
+			Identifier:     id,
+			SequenceNumber: seq,
+		},
+		Payload: data,
+	}
+
+	packetSerialized, err := p.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing ICMPv6 packet")
+	}
+	p.Header.Checksum, err = ipv6.PseudoHeaderChecksum(src, dest, ProtocolICMPv6, packetSerialized)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error calculating ICMPv6 checksum")
+	}
+
+	packetSerialized, err = p.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing ICMPv6 packet")
+	}
+
+	return p, packetSerialized, nil
+}
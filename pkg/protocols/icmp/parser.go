@@ -0,0 +1,109 @@
+package icmp
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/ipv6"
+)
+
+var (
+	// ErrTruncated is returned when the input is shorter than the message.
+	ErrTruncated = errors.New("truncated ICMP message")
+	// ErrMalformed is returned when the body of a message can't be decoded.
+	ErrMalformed = errors.New("malformed ICMP message")
+	// ErrInvalidChecksum is returned when the checksum doesn't match.
+	ErrInvalidChecksum = errors.New("invalid ICMP checksum")
+)
+
+func (*EchoBody) icmpBody()           {}
+func (*ErrorMessage) icmpBody()       {}
+func (*TimestampMessage) icmpBody()   {}
+func (*AddressMaskMessage) icmpBody() {}
+func (*InformationMessage) icmpBody() {}
+
+// Parse decodes an ICMP message, starting at its header, and verifies its
+// checksum. The type specific part of the message is decoded into Body.
+//
+// Errors wrap ErrTruncated, ErrMalformed or ErrInvalidChecksum.
+func Parse(b []byte) (*Packet, error) {
+	p, err := parseHeaderAndPayload(b)
+	if err != nil {
+		return nil, err
+	}
+	if protocols.CalculateChecksum(b) != 0 {
+		return nil, errors.Wrapf(ErrInvalidChecksum, "checksum 0x%04x", p.Header.Checksum)
+	}
+
+	switch hType := p.Header.Type; {
+	case hType == TypeEcho || hType == TypeEchoReply:
+		p.Body = &EchoBody{
+			Identifier:     p.Header.Identifier,
+			SequenceNumber: p.Header.SequenceNumber,
+			Data:           p.Payload,
+		}
+	case IsErrorMessage(hType):
+		p.Body, err = ParseErrorMessage(b)
+	case hType == TypeTimestamp || hType == TypeTimestampReply:
+		p.Body, err = ParseTimestampMessage(b)
+	case hType == TypeAddressMaskRequest || hType == TypeAddressMaskReply:
+		p.Body, err = ParseAddressMaskMessage(b)
+	case hType == TypeInformationRequest || hType == TypeInformationReply:
+		p.Body, err = ParseInformationMessage(b)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(ErrMalformed, "%v", err)
+	}
+	return p, nil
+}
+
+// ParseV6 decodes an ICMPv6 message, starting at its header. Only the bodies
+// of echo messages and of the error messages of IsErrorMessageV6 are decoded.
+//
+// The checksum covers a pseudo-header made of the source and destination
+// addresses, it is verified if both are given. The kernel verifies it before
+// passing up messages read from ICMPv6 sockets, which don't tell the
+// destination address; src and dest may be nil then.
+func ParseV6(b []byte, src, dest net.IP) (*Packet, error) {
+	p, err := parseHeaderAndPayload(b)
+	if err != nil {
+		return nil, err
+	}
+	if src != nil && dest != nil {
+		checksum, err := ipv6.PseudoHeaderChecksum(src, dest, ProtocolICMPv6, b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error calculating ICMPv6 checksum")
+		}
+		if checksum != 0 {
+			return nil, errors.Wrapf(ErrInvalidChecksum, "checksum 0x%04x", p.Header.Checksum)
+		}
+	}
+
+	switch hType := p.Header.Type; {
+	case hType == TypeEchoRequestV6 || hType == TypeEchoReplyV6:
+		p.Body = &EchoBody{
+			Identifier:     p.Header.Identifier,
+			SequenceNumber: p.Header.SequenceNumber,
+			Data:           p.Payload,
+		}
+	case IsErrorMessageV6(hType):
+		if p.Body, err = ParseErrorMessageV6(b); err != nil {
+			return nil, errors.Wrapf(ErrMalformed, "%v", err)
+		}
+	}
+	return p, nil
+}
+
+// parseHeaderAndPayload decodes the 8 byte header common to all messages, and
+// copies the bytes that follow it into the payload.
+func parseHeaderAndPayload(b []byte) (*Packet, error) {
+	headerSize := 8
+	if len(b) < headerSize {
+		return nil, errors.Wrapf(ErrTruncated, "%d bytes, header needs %d", len(b), headerSize)
+	}
+	return &Packet{
+		Header:  parseHeader(b),
+		Payload: append([]byte(nil), b[headerSize:]...),
+	}, nil
+}
@@ -0,0 +1,197 @@
+package icmp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+var (
+	// an echo request of identifier 0x1234 and sequence number 1, carrying "hi"
+	echoRequest = []byte{TypeEcho, 0, 0x7d, 0x61, 0x12, 0x34, 0, 1, 'h', 'i'}
+	// the reply to echoRequest
+	echoReply = []byte{TypeEchoReply, 0, 0x85, 0x61, 0x12, 0x34, 0, 1, 'h', 'i'}
+	// a timestamp request sent 100 ms past midnight UT
+	timestampRequest = []byte{
+		TypeTimestamp, 0, 0xe0, 0x66, 0x12, 0x34, 0, 1,
+		0, 0, 0, 100, 0, 0, 0, 0, 0, 0, 0, 0,
+	}
+	// an address mask reply for 255.255.255.0
+	addressMaskReply = []byte{TypeAddressMaskReply, 0, 0xdc, 0xc9, 0x12, 0x34, 0, 1, 255, 255, 255, 0}
+	// an information request, which is made of its header alone
+	informationRequest = []byte{TypeInformationRequest, 0, 0xde, 0xca, 0x12, 0x34, 0, 1}
+)
+
+func TestCreatePacket(t *testing.T) {
+	p, b, err := CreatePacket(TypeEcho, 0, 0, 0x1234, 1, []byte("hi"))
+	require.NoError(t, err)
+	assert.Equal(t, echoRequest, b)
+	assert.Equal(t, uint16(0x7d61), p.Header.Checksum)
+
+	_, b, err = CreatePacket(TypeEchoReply, 0, 0, 0x1234, 1, []byte("hi"))
+	require.NoError(t, err)
+	assert.Equal(t, echoReply, b)
+
+	// the checksum given is replaced
+	_, b, err = CreatePacket(TypeEcho, 0, 0xffff, 0x1234, 1, []byte("hi"))
+	require.NoError(t, err)
+	assert.Equal(t, echoRequest, b)
+}
+
+func TestCreateTimestampMessage(t *testing.T) {
+	m, b, err := CreateTimestampMessage(TypeTimestamp, 0, 0x1234, 1, 100, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, timestampRequest, b)
+	assert.Equal(t, uint32(100), m.Originate)
+}
+
+func TestCreateAddressMaskMessage(t *testing.T) {
+	_, b, err := CreateAddressMaskMessage(TypeAddressMaskReply, 0, 0x1234, 1, net.CIDRMask(24, 32))
+	require.NoError(t, err)
+	assert.Equal(t, addressMaskReply, b)
+
+	_, _, err = CreateAddressMaskMessage(TypeAddressMaskReply, 0, 0x1234, 1, net.CIDRMask(64, 128))
+	assert.Error(t, err)
+}
+
+func TestCreateInformationMessage(t *testing.T) {
+	m, b, err := CreateInformationMessage(TypeInformationRequest, 0, 0x1234, 1)
+	require.NoError(t, err)
+	assert.Equal(t, informationRequest, b)
+	assert.Equal(t, uint16(0xdeca), m.Header.Checksum)
+
+	parsed, err := ParseInformationMessage(b)
+	require.NoError(t, err)
+	assert.Equal(t, m, parsed)
+
+	_, err = ParseInformationMessage(b[:7])
+	assert.Error(t, err)
+	_, err = ParseInformationMessage(echoRequest)
+	assert.Error(t, err)
+}
+
+func TestParse(t *testing.T) {
+	unreachable := cat([]byte{TypeDestinationUnreachable, 3, 0, 0, 0, 0, 0, 0}, quotedIPv4, quotedEchoRequest)
+	withChecksum(unreachable)
+	unknown := []byte{42, 0, 0, 0, 1, 2, 3, 4, 5}
+	withChecksum(unknown)
+
+	tests := []struct {
+		name    string
+		message []byte
+		want    Body
+	}{
+		{
+			name:    "echo request",
+			message: echoRequest,
+			want:    &EchoBody{Identifier: 0x1234, SequenceNumber: 1, Data: []byte("hi")},
+		},
+		{
+			name:    "echo reply",
+			message: echoReply,
+			want:    &EchoBody{Identifier: 0x1234, SequenceNumber: 1, Data: []byte("hi")},
+		},
+		{
+			name:    "information request",
+			message: informationRequest,
+			want:    &InformationMessage{Header: &Header{Type: TypeInformationRequest, Checksum: 0xdeca, Identifier: 0x1234, SequenceNumber: 1}},
+		},
+		{
+			name:    "timestamp",
+			message: timestampRequest,
+			want: &TimestampMessage{
+				Header:    &Header{Type: TypeTimestamp, Checksum: 0xe066, Identifier: 0x1234, SequenceNumber: 1},
+				Originate: 100,
+			},
+		},
+		{
+			name:    "address mask",
+			message: addressMaskReply,
+			want: &AddressMaskMessage{
+				Header: &Header{Type: TypeAddressMaskReply, Checksum: 0xdcc9, Identifier: 0x1234, SequenceNumber: 1},
+				Mask:   net.CIDRMask(24, 32),
+			},
+		},
+		{
+			name:    "error message",
+			message: unreachable,
+			want: &ErrorMessage{
+				Type: TypeDestinationUnreachable, Code: 3,
+				OriginalHeader: quotedIPv4, OriginalData: quotedEchoRequest,
+			},
+		},
+		{
+			name:    "unknown type",
+			message: unknown,
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.message)
+			require.NoError(t, err)
+			assert.Equal(t, tt.message[0], p.Header.Type)
+			assert.Equal(t, append([]byte(nil), tt.message[8:]...), p.Payload)
+			assert.Equal(t, tt.want, p.Body)
+
+			// the packet serializes back to the message
+			b, err := p.Serialize()
+			require.NoError(t, err)
+			assert.Equal(t, tt.message, b)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	// a timestamp message too short for its timestamps
+	shortTimestamp := []byte{TypeTimestamp, 0, 0, 0, 0x12, 0x34, 0, 1, 0, 0, 0, 100}
+	withChecksum(shortTimestamp)
+
+	tests := []struct {
+		name    string
+		message []byte
+		wantErr error
+	}{
+		{"empty", nil, ErrTruncated},
+		{"truncated header", echoRequest[:7], ErrTruncated},
+		{"invalid checksum", append(append([]byte(nil), echoRequest[:9]...), 'o'), ErrInvalidChecksum},
+		{"zero checksum", cat(echoRequest[:2], []byte{0, 0}, echoRequest[4:]), ErrInvalidChecksum},
+		{"short timestamp", shortTimestamp, ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.message)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestParseV6Checksum(t *testing.T) {
+	src, dest := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	_, b, err := CreateV6Packet(TypeEchoRequestV6, 0, 0x1234, 1, src, dest, []byte("hi"))
+	require.NoError(t, err)
+
+	p, err := ParseV6(b, src, dest)
+	require.NoError(t, err)
+	assert.Equal(t, &EchoBody{Identifier: 0x1234, SequenceNumber: 1, Data: []byte("hi")}, p.Body)
+
+	// the checksum covers the addresses of the pseudo-header
+	_, err = ParseV6(b, src, net.ParseIP("2001:db8::3"))
+	assert.ErrorIs(t, err, ErrInvalidChecksum)
+
+	// without addresses, the checksum is left to the kernel
+	_, err = ParseV6(b, nil, nil)
+	assert.NoError(t, err)
+}
+
+// withChecksum sets the checksum of the ICMP message b.
+func withChecksum(b []byte) {
+	b[2], b[3] = 0, 0
+	checksum := protocols.CalculateChecksum(b)
+	b[2], b[3] = byte(checksum>>8), byte(checksum)
+}
@@ -0,0 +1,255 @@
+package icmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+var (
+	// timestampMessageSize is the size of a Timestamp message, header included
+	timestampMessageSize = 20
+	// addressMaskMessageSize is the size of an Address Mask message, header included
+	addressMaskMessageSize = 12
+	// informationMessageSize is the size of an Information message, which
+	// is its header
+	informationMessageSize = 8
+
+	// nonStandardTimestamp is the high order bit of a timestamp, set when
+	// the timestamp isn't in milliseconds since midnight UT
+	nonStandardTimestamp uint32 = 1 << 31
+
+	millisPerDay = uint32(24 * time.Hour / time.Millisecond)
+)
+
+// CreateTimestampMessage creates an ICMP Timestamp or Timestamp Reply message.
+// The checksum is computed.
+func CreateTimestampMessage(
+	hType,
+	code uint8,
+	id,
+	seq uint16,
+	originate,
+	receive,
+	transmit uint32,
+) (*TimestampMessage, []byte, error) {
+	m := &TimestampMessage{
+		Header: &Header{
+			Type:           hType,
+			Code:           code,
+			Identifier:     id,
+			SequenceNumber: seq,
+		},
+		Originate: originate,
+		Receive:   receive,
+		Transmit:  transmit,
+	}
+
+	messageSerialized, err := m.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing ICMP timestamp message")
+	}
+	m.Header.Checksum = protocols.CalculateChecksum(messageSerialized)
+
+	messageSerialized, err = m.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing ICMP timestamp message")
+	}
+
+	return m, messageSerialized, nil
+}
+
+func (m *TimestampMessage) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	headerSerialized, err := m.Header.Serialize()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error serializing ICMP message header")
+	}
+	buf.Write(headerSerialized)
+	if err := protocols.WriteBinary(buf, m.Originate, m.Receive, m.Transmit); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ParseTimestampMessage decodes an ICMP Timestamp or Timestamp Reply message,
+// starting at its ICMP header. The checksum is not verified.
+func ParseTimestampMessage(b []byte) (*TimestampMessage, error) {
+	if len(b) < timestampMessageSize {
+		return nil, errors.Errorf("ICMP timestamp message too short: %d bytes", len(b))
+	}
+	if b[0] != TypeTimestamp && b[0] != TypeTimestampReply {
+		return nil, errors.Errorf("not an ICMP timestamp message: type %d", b[0])
+	}
+
+	return &TimestampMessage{
+		Header:    parseHeader(b),
+		Originate: binary.BigEndian.Uint32(b[8:12]),
+		Receive:   binary.BigEndian.Uint32(b[12:16]),
+		Transmit:  binary.BigEndian.Uint32(b[16:20]),
+	}, nil
+}
+
+// CreateAddressMaskMessage creates an ICMP Address Mask Request or Reply
+// message. The checksum is computed.
+func CreateAddressMaskMessage(
+	hType,
+	code uint8,
+	id,
+	seq uint16,
+	mask net.IPMask,
+) (*AddressMaskMessage, []byte, error) {
+	m := &AddressMaskMessage{
+		Header: &Header{
+			Type:           hType,
+			Code:           code,
+			Identifier:     id,
+			SequenceNumber: seq,
+		},
+		Mask: mask,
+	}
+
+	messageSerialized, err := m.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing ICMP address mask message")
+	}
+	m.Header.Checksum = protocols.CalculateChecksum(messageSerialized)
+
+	messageSerialized, err = m.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing ICMP address mask message")
+	}
+
+	return m, messageSerialized, nil
+}
+
+func (m *AddressMaskMessage) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	headerSerialized, err := m.Header.Serialize()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error serializing ICMP message header")
+	}
+	buf.Write(headerSerialized)
+
+	// requests carry an all zero mask
+	mask := make([]byte, net.IPv4len)
+	if m.Mask != nil {
+		if len(m.Mask) != net.IPv4len {
+			return nil, errors.Errorf("invalid address mask %v", m.Mask)
+		}
+		copy(mask, m.Mask)
+	}
+	buf.Write(mask)
+
+	return buf.Bytes(), nil
+}
+
+// ParseAddressMaskMessage decodes an ICMP Address Mask Request or Reply
+// message, starting at its ICMP header. The checksum is not verified.
+func ParseAddressMaskMessage(b []byte) (*AddressMaskMessage, error) {
+	if len(b) < addressMaskMessageSize {
+		return nil, errors.Errorf("ICMP address mask message too short: %d bytes", len(b))
+	}
+	if b[0] != TypeAddressMaskRequest && b[0] != TypeAddressMaskReply {
+		return nil, errors.Errorf("not an ICMP address mask message: type %d", b[0])
+	}
+
+	return &AddressMaskMessage{
+		Header: parseHeader(b),
+		Mask:   net.IPMask(append([]byte(nil), b[8:12]...)),
+	}, nil
+}
+
+// CreateInformationMessage creates an ICMP Information Request or Information
+// Reply message. The checksum is computed.
+func CreateInformationMessage(
+	hType,
+	code uint8,
+	id,
+	seq uint16,
+) (*InformationMessage, []byte, error) {
+	m := &InformationMessage{
+		Header: &Header{
+			Type:           hType,
+			Code:           code,
+			Identifier:     id,
+			SequenceNumber: seq,
+		},
+	}
+
+	messageSerialized, err := m.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing ICMP information message")
+	}
+	m.Header.Checksum = protocols.CalculateChecksum(messageSerialized)
+
+	messageSerialized, err = m.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing ICMP information message")
+	}
+
+	return m, messageSerialized, nil
+}
+
+func (m *InformationMessage) Serialize() ([]byte, error) {
+	headerSerialized, err := m.Header.Serialize()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error serializing ICMP message header")
+	}
+	return headerSerialized, nil
+}
+
+// ParseInformationMessage decodes an ICMP Information Request or Information
+// Reply message, starting at its ICMP header. The checksum is not verified.
+func ParseInformationMessage(b []byte) (*InformationMessage, error) {
+	if len(b) < informationMessageSize {
+		return nil, errors.Errorf("ICMP information message too short: %d bytes", len(b))
+	}
+	if b[0] != TypeInformationRequest && b[0] != TypeInformationReply {
+		return nil, errors.Errorf("not an ICMP information message: type %d", b[0])
+	}
+
+	return &InformationMessage{Header: parseHeader(b)}, nil
+}
+
+// parseHeader decodes the 8 byte header shared by ICMP messages.
+func parseHeader(b []byte) *Header {
+	return &Header{
+		Type:           b[0],
+		Code:           b[1],
+		Checksum:       binary.BigEndian.Uint16(b[2:4]),
+		Identifier:     binary.BigEndian.Uint16(b[4:6]),
+		SequenceNumber: binary.BigEndian.Uint16(b[6:8]),
+	}
+}
+
+// Timestamp returns t as an ICMP timestamp, in milliseconds since midnight UT.
+func Timestamp(t time.Time) uint32 {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return uint32(t.Sub(midnight) / time.Millisecond)
+}
+
+// IsStandardTimestamp reports whether ts is in milliseconds since midnight UT.
+// Hosts that can't provide such a time set the high order bit of the timestamp.
+func IsStandardTimestamp(ts uint32) bool {
+	return ts&nonStandardTimestamp == 0
+}
+
+// TimestampDiff returns the time elapsed from timestamp a to timestamp b, both
+// in milliseconds since midnight UT. Timestamps wrap around at midnight, the
+// difference is taken to be the one of smallest magnitude.
+func TimestampDiff(a, b uint32) time.Duration {
+	diff := (int64(b) - int64(a)) % int64(millisPerDay)
+	if diff >= int64(millisPerDay)/2 {
+		diff -= int64(millisPerDay)
+	} else if diff < -int64(millisPerDay)/2 {
+		diff += int64(millisPerDay)
+	}
+	return time.Duration(diff) * time.Millisecond
+}
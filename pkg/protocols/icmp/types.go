@@ -1,5 +1,57 @@
 package icmp
 
+import "net"
+
+var (
+	// ICMP message types, as defined in RFC 792
+	TypeEchoReply              uint8 = 0
+	TypeDestinationUnreachable uint8 = 3
+	TypeSourceQuench           uint8 = 4
+	TypeRedirect               uint8 = 5
+	TypeEcho                   uint8 = 8
+	TypeTimeExceeded           uint8 = 11
+	TypeParameterProblem       uint8 = 12
+	TypeTimestamp              uint8 = 13
+	TypeTimestampReply         uint8 = 14
+	TypeInformationRequest     uint8 = 15
+	TypeInformationReply       uint8 = 16
+
+	// Address Mask message types, as defined in RFC 950
+	TypeAddressMaskRequest uint8 = 17
+	TypeAddressMaskReply   uint8 = 18
+
+	// ICMPv6 echo message types, as defined in RFC 4443
+	TypeEchoRequestV6 uint8 = 128
+	TypeEchoReplyV6   uint8 = 129
+
+	// ICMPv6 error message types, as defined in RFC 4443
+	TypeDestinationUnreachableV6 uint8 = 1
+	TypePacketTooBigV6           uint8 = 2
+	TypeTimeExceededV6           uint8 = 3
+
+	// ProtocolICMPv6 is the IPv6 Next Header value identifying ICMPv6
+	ProtocolICMPv6 uint8 = 58
+
+	// ExtensionVersion is the version of the RFC 4884 extension structure
+	ExtensionVersion uint8 = 2
+
+	// Classes of RFC 4884 extension objects, as defined in RFC 4950 and RFC 5837
+	ClassMPLSLabelStack       uint8 = 1
+	ClassInterfaceInformation uint8 = 2
+
+	// CodePortUnreachable is the Destination Unreachable code sent by a
+	// host that has no process listening on the destination port.
+	CodePortUnreachable uint8 = 3
+
+	// CodeFragmentationNeeded is the Destination Unreachable code sent by a
+	// router that had to fragment a datagram with the Don't Fragment flag set.
+	CodeFragmentationNeeded uint8 = 4
+
+	// CodePortUnreachableV6 is the ICMPv6 Destination Unreachable code sent
+	// by a host that has no process listening on the destination port.
+	CodePortUnreachableV6 uint8 = 4
+)
+
 // Header represents the header of an ICMP (Internet Control Message Protocol) packet.
 // It contains fields for the ICMP message type, code, checksum, identifier, and sequence number.
 type Header struct {
@@ -15,4 +67,98 @@ type Header struct {
 type Packet struct {
 	Header  *Header
 	Payload []byte
+	// Body is the type specific part of the message, decoded by Parse.
+	// It is nil for packets that are created, and for unknown types.
+	Body Body
+}
+
+// Body is the type specific part of an ICMP message, as decoded by Parse. It
+// is one of *EchoBody, *ErrorMessage, *TimestampMessage, *AddressMaskMessage
+// or *InformationMessage.
+type Body interface {
+	icmpBody()
+}
+
+// EchoBody is the body of an Echo or Echo Reply message.
+type EchoBody struct {
+	Identifier     uint16
+	SequenceNumber uint16
+	Data           []byte
+}
+
+// ExtensionObject is an object of the extension structure that RFC 4884 lets
+// routers append to Destination Unreachable, Time Exceeded and Parameter
+// Problem messages, eg: the MPLS label stack of the discarded datagram.
+type ExtensionObject struct {
+	ClassNum uint8
+	CType    uint8
+	// Data holds the object payload, past its 4 byte header.
+	Data []byte
+}
+
+// ErrorMessage represents an ICMP error message, i.e. Destination Unreachable,
+// Source Quench, Redirect or Time Exceeded, or an ICMPv6 error message, i.e.
+// Destination Unreachable, Packet Too Big or Time Exceeded. These messages are
+// sent back to the source of a datagram that couldn't be delivered, and quote
+// the IP header and at least the first 8 bytes of that datagram.
+type ErrorMessage struct {
+	Type uint8
+	Code uint8
+
+	// Gateway is the address of the router to which traffic should be
+	// sent instead. It is only set for Redirect messages.
+	Gateway net.IP
+
+	// Pointer is the offset of the octet where an error was detected in
+	// the original datagram. It is only set for Parameter Problem messages.
+	Pointer uint8
+
+	// NextHopMTU is the MTU of the link the datagram couldn't be forwarded
+	// over. It is only set for Destination Unreachable messages with code
+	// 4 (fragmentation needed), and may be zero for routers predating RFC 1191,
+	// and for ICMPv6 Packet Too Big messages, in which case it is capped to
+	// 65535.
+	NextHopMTU uint16
+
+	// OriginalHeader is the IP header of the datagram that caused the error,
+	// an IPv6 header for ICMPv6 messages.
+	OriginalHeader []byte
+
+	// OriginalData holds the bytes of the original datagram that follow its
+	// IP header. RFC 792 only guarantees the first 8 bytes, which is enough
+	// to hold an ICMP, UDP or TCP header's ports and identifiers.
+	OriginalData []byte
+
+	// Extensions holds the RFC 4884 extension objects that follow the
+	// original datagram, if any.
+	Extensions []ExtensionObject
+}
+
+// TimestampMessage represents an ICMP Timestamp or Timestamp Reply message.
+// Timestamps are in milliseconds since midnight UT. A timestamp with its high
+// order bit set isn't in that standard format, see IsStandardTimestamp.
+type TimestampMessage struct {
+	Header *Header
+	// Originate is the time the sender last touched the message before sending it.
+	Originate uint32
+	// Receive is the time the echoer first touched the message on receipt.
+	Receive uint32
+	// Transmit is the time the echoer last touched the message before sending the reply.
+	Transmit uint32
+}
+
+// InformationMessage represents an ICMP Information Request or Information
+// Reply message (RFC 792), by which a host used to learn the number of its
+// network. It is made of the header alone, the request being sent with zero
+// network fields in the source and destination addresses of its IP header.
+// RFC 6918 has deprecated it, hosts seldom answer it nowadays.
+type InformationMessage struct {
+	Header *Header
+}
+
+// AddressMaskMessage represents an ICMP Address Mask Request or Reply message.
+type AddressMaskMessage struct {
+	Header *Header
+	// Mask is the subnet mask, left zero in requests.
+	Mask net.IPMask
 }
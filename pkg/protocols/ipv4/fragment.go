@@ -0,0 +1,108 @@
+package ipv4
+
+import (
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+var (
+	// ErrFragmentationNeeded is returned when a packet larger than the MTU
+	// has the Don't Fragment flag set.
+	ErrFragmentationNeeded = errors.New("fragmentation needed and Don't Fragment set")
+
+	// MaxPacketSize is the largest datagram the total length can describe
+	MaxPacketSize = 65535
+)
+
+var (
+	// fragmentUnit is the unit of the fragment offset, in octets
+	fragmentUnit = 8
+	// optionCopied is the flag of the option types that are copied into
+	// every fragment, the other ones only go into the first fragment
+	optionCopied uint8 = 0x80
+)
+
+// Fragment splits p into fragments that fit in mtu octets, header included, as
+// described in RFC 791. Every fragment carries a copy of the header of p, with
+// only the options marked to be copied past the first fragment. p is returned
+// as is if it already fits.
+//
+// p may itself be a fragment, in which case its offset and More Fragments flag
+// are carried over to the fragments it is split into.
+func Fragment(p *Packet, mtu int) ([]*Packet, error) {
+	header := p.Header
+	headerLength := int(header.IHL) * 4
+	if headerLength+len(p.Payload) <= mtu {
+		return []*Packet{p}, nil
+	}
+	if header.Flags&FlagDontFragment != 0 {
+		return nil, errors.Wrapf(ErrFragmentationNeeded, "%d bytes, mtu %d", headerLength+len(p.Payload), mtu)
+	}
+
+	var copied []Option
+	for _, o := range header.Options {
+		if o.Type()&optionCopied != 0 {
+			copied = append(copied, o)
+		}
+	}
+
+	var fragments []*Packet
+	options := header.Options
+	for offset := 0; offset < len(p.Payload); {
+		fragmentHeader := *header
+		fragmentHeader.Options = options
+		if err := fragmentHeader.updateLength(0); err != nil {
+			return nil, errors.Wrapf(err, "error creating fragment header")
+		}
+
+		room := (mtu - int(fragmentHeader.IHL)*4) / fragmentUnit * fragmentUnit
+		if room <= 0 {
+			return nil, errors.Errorf("mtu %d leaves no room for data past a %d byte header", mtu, int(fragmentHeader.IHL)*4)
+		}
+		end := offset + room
+		fragmentHeader.Flags |= FlagMoreFragments
+		if end >= len(p.Payload) {
+			end = len(p.Payload)
+			// the last fragment of p is only the last of the datagram if
+			// p was
+			fragmentHeader.Flags = fragmentHeader.Flags&^FlagMoreFragments | header.Flags&FlagMoreFragments
+		}
+		fragmentHeader.FragmentOffset = header.FragmentOffset + uint16(offset/fragmentUnit)
+
+		payload := p.Payload[offset:end]
+		if err := fragmentHeader.updateLength(len(payload)); err != nil {
+			return nil, errors.Wrapf(err, "error creating fragment header")
+		}
+		fragments = append(fragments, &Packet{Header: &fragmentHeader, Payload: payload})
+
+		offset = end
+		options = copied
+	}
+	return fragments, nil
+}
+
+// updateLength sets the header length, the total length of a datagram carrying
+// payloadLength octets and the checksum, after the fields of h have changed.
+func (h *Header) updateLength(payloadLength int) error {
+	h.IHL = uint8(HeaderSize / 4)
+	if len(h.Options) > 0 {
+		headerLength, err := calculateHeaderLength(h.Options)
+		if err != nil {
+			return err
+		}
+		h.IHL = headerLength
+	}
+	totalLength := int(h.IHL)*4 + payloadLength
+	if totalLength > MaxPacketSize {
+		return errors.Errorf("datagram of %d bytes too large", totalLength)
+	}
+	h.TotalLength = uint16(totalLength)
+
+	h.Checksum = 0
+	b, err := h.Serialize()
+	if err != nil {
+		return err
+	}
+	h.Checksum = protocols.CalculateChecksum(b)
+	return nil
+}
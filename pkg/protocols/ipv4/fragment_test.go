@@ -0,0 +1,136 @@
+package ipv4
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDatagram returns a datagram from 192.0.2.1 to 192.0.2.2 carrying size
+// octets of payload, each octet being its own offset modulo 256.
+func newDatagram(t *testing.T, flags uint8, size int, options ...Option) *Packet {
+	payload := make([]byte, size)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	p, _, err := CreatePacket(4, 5, 0, flags, 64, 17, 0, 0x1234, 0, 0, net.IP{192, 0, 2, 1}, net.IP{192, 0, 2, 2}, payload, options...)
+	require.NoError(t, err)
+	return p
+}
+
+func TestFragment(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        int
+		mtu         int
+		wantOffsets []uint16
+		wantSizes   []int
+	}{
+		{name: "fits", size: 100, mtu: 120, wantOffsets: []uint16{0}, wantSizes: []int{100}},
+		{name: "fits exactly", size: 100, mtu: 20 + 100, wantOffsets: []uint16{0}, wantSizes: []int{100}},
+		{name: "split", size: 100, mtu: 44, wantOffsets: []uint16{0, 3, 6, 9, 12}, wantSizes: []int{24, 24, 24, 24, 4}},
+		// the data of every fragment but the last is a multiple of 8 octets
+		{name: "rounded down", size: 100, mtu: 50, wantOffsets: []uint16{0, 3, 6, 9, 12}, wantSizes: []int{24, 24, 24, 24, 4}},
+		{name: "last fragment full", size: 48, mtu: 44, wantOffsets: []uint16{0, 3}, wantSizes: []int{24, 24}},
+		{name: "ethernet", size: 3000, mtu: 1500, wantOffsets: []uint16{0, 185, 370}, wantSizes: []int{1480, 1480, 40}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newDatagram(t, 0, tt.size)
+			fragments, err := Fragment(p, tt.mtu)
+			require.NoError(t, err)
+			require.Len(t, fragments, len(tt.wantOffsets))
+
+			var payload []byte
+			for i, f := range fragments {
+				assert.Equal(t, tt.wantOffsets[i], f.Header.FragmentOffset)
+				assert.Len(t, f.Payload, tt.wantSizes[i])
+				assert.Equal(t, i < len(fragments)-1, f.Header.Flags&FlagMoreFragments != 0)
+				assert.Equal(t, uint16(0x1234), f.Header.Identification)
+
+				b, err := f.Serialize()
+				require.NoError(t, err)
+				assert.LessOrEqual(t, len(b), tt.mtu)
+				assert.Equal(t, int(f.Header.TotalLength), len(b))
+				// the checksum of every fragment header is valid
+				parsed, err := Parse(b)
+				require.NoError(t, err)
+				assert.Equal(t, f.Payload, parsed.Payload)
+
+				payload = append(payload, f.Payload...)
+			}
+			assert.Equal(t, p.Payload, payload)
+		})
+	}
+}
+
+func TestFragmentDontFragment(t *testing.T) {
+	p := newDatagram(t, FlagDontFragment, 100)
+
+	_, err := Fragment(p, 100)
+	assert.ErrorIs(t, err, ErrFragmentationNeeded)
+
+	fragments, err := Fragment(p, 120)
+	require.NoError(t, err)
+	assert.Equal(t, []*Packet{p}, fragments)
+}
+
+func TestFragmentOptions(t *testing.T) {
+	// Loose Source Route is copied into every fragment, Record Route only
+	// goes into the first one
+	sourceRoute := NewSourceRouteOption(false, []net.IP{{198, 51, 100, 1}})
+	recordRoute := NewRecordRouteOption(2)
+	p := newDatagram(t, 0, 80, sourceRoute, recordRoute)
+	require.Equal(t, uint8(10), p.Header.IHL)
+
+	fragments, err := Fragment(p, 72)
+	require.NoError(t, err)
+	require.Len(t, fragments, 3)
+
+	first := fragments[0].Header
+	assert.Equal(t, []Option{sourceRoute, recordRoute}, first.Options)
+	assert.Equal(t, uint8(10), first.IHL)
+	assert.Len(t, fragments[0].Payload, 32)
+
+	for _, f := range fragments[1:] {
+		assert.Equal(t, []Option{sourceRoute}, f.Header.Options)
+		assert.Equal(t, uint8(7), f.Header.IHL)
+		b, err := f.Serialize()
+		require.NoError(t, err)
+		_, err = Parse(b)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, uint16(4), fragments[1].Header.FragmentOffset)
+	assert.Len(t, fragments[1].Payload, 40)
+	assert.Equal(t, uint16(9), fragments[2].Header.FragmentOffset)
+	assert.Len(t, fragments[2].Payload, 8)
+
+	// the header of p is left untouched
+	assert.Equal(t, []Option{sourceRoute, recordRoute}, p.Header.Options)
+	assert.Equal(t, uint16(0), p.Header.FragmentOffset)
+}
+
+func TestFragmentFragment(t *testing.T) {
+	// a fragment in the middle of a datagram keeps its More Fragments flag
+	// on its last piece, and its offset is carried over
+	p := newDatagram(t, FlagMoreFragments, 48)
+	p.Header.FragmentOffset = 10
+
+	fragments, err := Fragment(p, 44)
+	require.NoError(t, err)
+	require.Len(t, fragments, 2)
+	for _, f := range fragments {
+		assert.NotZero(t, f.Header.Flags&FlagMoreFragments)
+	}
+	assert.Equal(t, uint16(10), fragments[0].Header.FragmentOffset)
+	assert.Equal(t, uint16(13), fragments[1].Header.FragmentOffset)
+}
+
+func TestFragmentMTUTooSmall(t *testing.T) {
+	p := newDatagram(t, 0, 100)
+	_, err := Fragment(p, 27)
+	assert.Error(t, err)
+}
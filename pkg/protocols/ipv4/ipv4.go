@@ -7,15 +7,34 @@ import (
 	"github.com/swagnikdutta/netprobe/pkg/protocols"
 )
 
+// HeaderSize is the size of an IPv4 header without options.
+var HeaderSize = 20
+
 func calculateTotalLength(p *Packet) (*uint16, error) {
 	b, err := p.Serialize()
 	if err != nil {
 		return nil, errors.Wrapf(err, "error serializing ip packet")
 	}
+	if len(b) > MaxPacketSize {
+		return nil, errors.Errorf("packet of %d bytes too large, at most %d fit in the total length", len(b), MaxPacketSize)
+	}
 	length := uint16(len(b))
 	return &length, nil
 }
 
+// calculateHeaderLength returns the length, in 32 bit words, of a header
+// carrying options.
+func calculateHeaderLength(options []Option) (uint8, error) {
+	b, err := SerializeOptions(options)
+	if err != nil {
+		return 0, err
+	}
+	return uint8((HeaderSize + len(b)) / 4), nil
+}
+
+// CreatePacket creates an IPv4 packet carrying payload. The total length and
+// the checksum are computed. When options are given, the header length ihl
+// is computed as well, from the size of the padded options.
 func CreatePacket(
 	version,
 	ihl,
@@ -30,6 +49,7 @@ func CreatePacket(
 	src,
 	dest net.IP,
 	payload []byte,
+	options ...Option,
 ) (*Packet, []byte, error) {
 	p := &Packet{
 		Header: &Header{
@@ -49,6 +69,15 @@ func CreatePacket(
 		Payload: payload,
 	}
 
+	if options != nil {
+		headerLength, err := calculateHeaderLength(options)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "error calculating header length of packet")
+		}
+		p.Header.Options = options
+		p.Header.IHL = headerLength
+	}
+
 	length, err := calculateTotalLength(p)
 	if err != nil {
 		return nil, nil, errors.Wrapf(err, "error calculating total length of packet")
@@ -68,3 +97,16 @@ func CreatePacket(
 
 	return p, packetSerialized, nil
 }
+
+// PseudoHeaderChecksum calculates the checksum of an upper-layer packet, such
+// as UDP or TCP, carried over IPv4. The checksum covers a pseudo-header made of
+// the source and destination addresses, the protocol and the upper-layer
+// packet length, as described in RFC 768 and RFC 793.
+func PseudoHeaderChecksum(src, dest net.IP, proto uint8, payload []byte) (uint16, error) {
+	src4, dest4 := src.To4(), dest.To4()
+	if src4 == nil || dest4 == nil {
+		return 0, errors.Errorf("invalid IPv4 address pair %v, %v", src, dest)
+	}
+
+	return protocols.Checksum(src4, dest4, proto, payload)
+}
@@ -0,0 +1,344 @@
+package ipv4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Option types, made of the copied flag, the option class and the option
+	// number, as defined in RFC 791 and RFC 2113
+	OptionEndOfList         uint8 = 0
+	OptionNoOperation       uint8 = 1
+	OptionRecordRoute       uint8 = 7
+	OptionTimestamp         uint8 = 68
+	OptionLooseSourceRoute  uint8 = 131
+	OptionStrictSourceRoute uint8 = 137
+	OptionRouterAlert       uint8 = 148
+
+	// Flags of the Timestamp option, telling what each entry is made of
+	TimestampOnly         uint8 = 0
+	TimestampAndAddress   uint8 = 1
+	TimestampPrespecified uint8 = 3
+
+	// MaxOptionsSize is the room left for options by the largest IHL, 15 words
+	MaxOptionsSize = 40
+)
+
+var (
+	// route options start with their type, length and pointer octets
+	routeOptionOverhead = 3
+	// the Timestamp option also has an overflow and flag octet
+	timestampOptionOverhead = 4
+	// pointers are counted from 1, the first address follows the pointer
+	firstPointer          uint8 = 4
+	routerAlertOptionSize uint8 = 4
+)
+
+// Option is an IPv4 header option.
+type Option interface {
+	// Type returns the option type, eg: OptionRecordRoute.
+	Type() uint8
+	// Serialize returns the option as it appears in the header, type and
+	// length octets included.
+	Serialize() ([]byte, error)
+}
+
+// RouteOption is a Record Route, Loose Source Route or Strict Source Route
+// option. Each of them holds a list of addresses, and a pointer to the octet
+// where the next address is to be read or recorded, counted from 1.
+type RouteOption struct {
+	OptionType uint8
+	Pointer    uint8
+	// Addresses holds the route. Slots of a Record Route option that have
+	// not been filled by routers yet are left zero.
+	Addresses []net.IP
+}
+
+// NewRecordRouteOption returns a Record Route option with room for slots
+// addresses. At most 9 addresses fit in the options of a header.
+func NewRecordRouteOption(slots int) *RouteOption {
+	o := &RouteOption{OptionType: OptionRecordRoute, Pointer: firstPointer}
+	for i := 0; i < slots; i++ {
+		o.Addresses = append(o.Addresses, net.IPv4zero.To4())
+	}
+	return o
+}
+
+// NewSourceRouteOption returns a Loose Source Route option, or a Strict
+// Source Route option if strict is set, through the addresses in route.
+func NewSourceRouteOption(strict bool, route []net.IP) *RouteOption {
+	o := &RouteOption{OptionType: OptionLooseSourceRoute, Pointer: firstPointer, Addresses: route}
+	if strict {
+		o.OptionType = OptionStrictSourceRoute
+	}
+	return o
+}
+
+func (o *RouteOption) Type() uint8 {
+	return o.OptionType
+}
+
+// Recorded returns the addresses that the pointer has already gone past,
+// i.e. the route recorded so far, or the part of the source route travelled.
+func (o *RouteOption) Recorded() []net.IP {
+	n := (int(o.Pointer) - int(firstPointer)) / net.IPv4len
+	if n < 0 {
+		return nil
+	}
+	if n > len(o.Addresses) {
+		n = len(o.Addresses)
+	}
+	return o.Addresses[:n]
+}
+
+func (o *RouteOption) Serialize() ([]byte, error) {
+	length := routeOptionOverhead + net.IPv4len*len(o.Addresses)
+	if length > MaxOptionsSize {
+		return nil, errors.Errorf("route option can't hold %d addresses", len(o.Addresses))
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{o.OptionType, uint8(length), o.Pointer})
+	for _, addr := range o.Addresses {
+		ip := addr.To4()
+		if ip == nil {
+			return nil, errors.Errorf("invalid IPv4 address %v", addr)
+		}
+		buf.Write(ip)
+	}
+	return buf.Bytes(), nil
+}
+
+// TimestampEntry is an entry of a Timestamp option. Address is only set when
+// the option flag is TimestampAndAddress or TimestampPrespecified.
+type TimestampEntry struct {
+	Address   net.IP
+	Timestamp uint32
+}
+
+// TimestampOption is an Internet Timestamp option. Timestamps are in
+// milliseconds since midnight UT, as in ICMP timestamp messages.
+type TimestampOption struct {
+	Pointer uint8
+	// Overflow is the number of hosts that couldn't register a timestamp
+	// for lack of room.
+	Overflow uint8
+	Flag     uint8
+	Entries  []TimestampEntry
+}
+
+// NewTimestampOption returns a Timestamp option with room for slots entries,
+// made of what flag tells. With TimestampPrespecified, only the hosts listed
+// in addresses register a timestamp and slots is ignored.
+func NewTimestampOption(flag uint8, slots int, addresses []net.IP) *TimestampOption {
+	o := &TimestampOption{Pointer: firstPointer + 1, Flag: flag}
+	if flag == TimestampPrespecified {
+		for _, addr := range addresses {
+			o.Entries = append(o.Entries, TimestampEntry{Address: addr})
+		}
+		return o
+	}
+	for i := 0; i < slots; i++ {
+		entry := TimestampEntry{}
+		if flag == TimestampAndAddress {
+			entry.Address = net.IPv4zero.To4()
+		}
+		o.Entries = append(o.Entries, entry)
+	}
+	return o
+}
+
+func (o *TimestampOption) Type() uint8 {
+	return OptionTimestamp
+}
+
+// entrySize returns the size of an entry, which depends on the option flag.
+func (o *TimestampOption) entrySize() int {
+	if o.Flag == TimestampOnly {
+		return 4
+	}
+	return 4 + net.IPv4len
+}
+
+// Recorded returns the entries that have been filled in so far.
+func (o *TimestampOption) Recorded() []TimestampEntry {
+	n := (int(o.Pointer) - int(firstPointer) - 1) / o.entrySize()
+	if n < 0 {
+		return nil
+	}
+	if n > len(o.Entries) {
+		n = len(o.Entries)
+	}
+	return o.Entries[:n]
+}
+
+func (o *TimestampOption) Serialize() ([]byte, error) {
+	length := timestampOptionOverhead + o.entrySize()*len(o.Entries)
+	if length > MaxOptionsSize {
+		return nil, errors.Errorf("timestamp option can't hold %d entries", len(o.Entries))
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{OptionTimestamp, uint8(length), o.Pointer, o.Overflow<<4 | o.Flag&0x0f})
+	for _, entry := range o.Entries {
+		if o.Flag != TimestampOnly {
+			ip := entry.Address.To4()
+			if ip == nil {
+				return nil, errors.Errorf("invalid IPv4 address %v", entry.Address)
+			}
+			buf.Write(ip)
+		}
+		if err := binary.Write(buf, binary.BigEndian, entry.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// RouterAlertOption asks routers to examine the datagram more closely, as
+// needed by protocols such as IGMP and RSVP (RFC 2113).
+type RouterAlertOption struct {
+	// Value is zero when routers shall examine the packet.
+	Value uint16
+}
+
+func (o *RouterAlertOption) Type() uint8 {
+	return OptionRouterAlert
+}
+
+func (o *RouterAlertOption) Serialize() ([]byte, error) {
+	b := []byte{OptionRouterAlert, routerAlertOptionSize, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], o.Value)
+	return b, nil
+}
+
+// NoOperationOption is used between options, eg: to align the next option
+// on a 32 bit boundary.
+type NoOperationOption struct{}
+
+func (o *NoOperationOption) Type() uint8 {
+	return OptionNoOperation
+}
+
+func (o *NoOperationOption) Serialize() ([]byte, error) {
+	return []byte{OptionNoOperation}, nil
+}
+
+// UnknownOption holds an option of a type that isn't decoded.
+type UnknownOption struct {
+	OptionType uint8
+	// Data holds the option, past its type and length octets.
+	Data []byte
+}
+
+func (o *UnknownOption) Type() uint8 {
+	return o.OptionType
+}
+
+func (o *UnknownOption) Serialize() ([]byte, error) {
+	if len(o.Data)+2 > MaxOptionsSize {
+		return nil, errors.Errorf("option of type %d too long: %d bytes", o.OptionType, len(o.Data))
+	}
+	return append([]byte{o.OptionType, uint8(len(o.Data) + 2)}, o.Data...), nil
+}
+
+// SerializeOptions returns options as they appear in the header, padded with
+// End of Option List octets to a multiple of 4 bytes, as the header length is
+// counted in 32 bit words.
+func SerializeOptions(options []Option) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for _, o := range options {
+		b, err := o.Serialize()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error serializing IPv4 option %d", o.Type())
+		}
+		buf.Write(b)
+	}
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(OptionEndOfList)
+	}
+
+	if buf.Len() > MaxOptionsSize {
+		return nil, errors.Errorf("IPv4 options too long: %d bytes, at most %d fit in the header", buf.Len(), MaxOptionsSize)
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseOptions decodes the options of an IPv4 header, i.e. the bytes that
+// follow its first 20 bytes. Padding and End of Option List are dropped.
+func ParseOptions(b []byte) ([]Option, error) {
+	var options []Option
+	for i := 0; i < len(b); {
+		optionType := b[i]
+		if optionType == OptionEndOfList {
+			break
+		}
+		if optionType == OptionNoOperation {
+			options = append(options, &NoOperationOption{})
+			i++
+			continue
+		}
+
+		if i+2 > len(b) {
+			return nil, errors.Errorf("truncated IPv4 option %d", optionType)
+		}
+		length := int(b[i+1])
+		if length < 2 || i+length > len(b) {
+			return nil, errors.Errorf("invalid length %d of IPv4 option %d", length, optionType)
+		}
+		o, err := parseOption(optionType, b[i:i+length])
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, o)
+		i += length
+	}
+	return options, nil
+}
+
+func parseOption(optionType uint8, b []byte) (Option, error) {
+	switch optionType {
+	case OptionRecordRoute, OptionLooseSourceRoute, OptionStrictSourceRoute:
+		if len(b) < routeOptionOverhead || (len(b)-routeOptionOverhead)%net.IPv4len != 0 {
+			return nil, errors.Errorf("invalid length %d of IPv4 route option", len(b))
+		}
+		o := &RouteOption{OptionType: optionType, Pointer: b[2]}
+		for i := routeOptionOverhead; i < len(b); i += net.IPv4len {
+			o.Addresses = append(o.Addresses, net.IP(append([]byte(nil), b[i:i+net.IPv4len]...)))
+		}
+		return o, nil
+
+	case OptionTimestamp:
+		if len(b) < timestampOptionOverhead {
+			return nil, errors.Errorf("invalid length %d of IPv4 timestamp option", len(b))
+		}
+		o := &TimestampOption{Pointer: b[2], Overflow: b[3] >> 4, Flag: b[3] & 0x0f}
+		size := o.entrySize()
+		if (len(b)-timestampOptionOverhead)%size != 0 {
+			return nil, errors.Errorf("invalid length %d of IPv4 timestamp option", len(b))
+		}
+		for i := timestampOptionOverhead; i < len(b); i += size {
+			entry := TimestampEntry{}
+			j := i
+			if o.Flag != TimestampOnly {
+				entry.Address = net.IP(append([]byte(nil), b[j:j+net.IPv4len]...))
+				j += net.IPv4len
+			}
+			entry.Timestamp = binary.BigEndian.Uint32(b[j : j+4])
+			o.Entries = append(o.Entries, entry)
+		}
+		return o, nil
+
+	case OptionRouterAlert:
+		if len(b) != int(routerAlertOptionSize) {
+			return nil, errors.Errorf("invalid length %d of IPv4 router alert option", len(b))
+		}
+		return &RouterAlertOption{Value: binary.BigEndian.Uint16(b[2:4])}, nil
+	}
+
+	return &UnknownOption{OptionType: optionType, Data: append([]byte(nil), b[2:]...)}, nil
+}
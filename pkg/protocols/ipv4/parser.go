@@ -0,0 +1,82 @@
+package ipv4
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+var (
+	// ErrTruncated is returned when the input is shorter than the header,
+	// or than the total length it announces.
+	ErrTruncated = errors.New("truncated IPv4 packet")
+	// ErrMalformed is returned when a header field holds an impossible value.
+	ErrMalformed = errors.New("malformed IPv4 packet")
+	// ErrInvalidChecksum is returned when the header checksum doesn't match.
+	ErrInvalidChecksum = errors.New("invalid IPv4 header checksum")
+)
+
+// Parse decodes an IPv4 packet, header options included. Bytes past the total
+// length announced by the header, such as link layer padding, are ignored.
+//
+// Errors wrap ErrTruncated, ErrMalformed or ErrInvalidChecksum. On a checksum
+// mismatch the decoded packet is returned along with the error: hosts record
+// themselves in options such as Record Route without updating the checksum of
+// the packets they deliver locally, it is up to the caller to accept them.
+func Parse(b []byte) (*Packet, error) {
+	if len(b) < HeaderSize {
+		return nil, errors.Wrapf(ErrTruncated, "%d bytes, header needs %d", len(b), HeaderSize)
+	}
+
+	version, ihl := b[0]>>4, b[0]&0x0f
+	if version != 4 {
+		return nil, errors.Wrapf(ErrMalformed, "version %d", version)
+	}
+	headerLength := int(ihl) * 4
+	if headerLength < HeaderSize {
+		return nil, errors.Wrapf(ErrMalformed, "header length %d", headerLength)
+	}
+	if len(b) < headerLength {
+		return nil, errors.Wrapf(ErrTruncated, "%d bytes, header needs %d", len(b), headerLength)
+	}
+
+	totalLength := binary.BigEndian.Uint16(b[2:4])
+	if int(totalLength) < headerLength {
+		return nil, errors.Wrapf(ErrMalformed, "total length %d shorter than header length %d", totalLength, headerLength)
+	}
+	if len(b) < int(totalLength) {
+		return nil, errors.Wrapf(ErrTruncated, "%d bytes, total length is %d", len(b), totalLength)
+	}
+
+	options, err := ParseOptions(b[HeaderSize:headerLength])
+	if err != nil {
+		return nil, errors.Wrapf(ErrMalformed, "%v", err)
+	}
+
+	flagsAndOffset := binary.BigEndian.Uint16(b[6:8])
+	p := &Packet{
+		Header: &Header{
+			Version:        version,
+			IHL:            ihl,
+			TypeOfService:  b[1],
+			TotalLength:    totalLength,
+			Identification: binary.BigEndian.Uint16(b[4:6]),
+			Flags:          uint8(flagsAndOffset >> 13),
+			FragmentOffset: flagsAndOffset & 0x1fff,
+			TTL:            b[8],
+			Protocol:       b[9],
+			Checksum:       binary.BigEndian.Uint16(b[10:12]),
+			SourceIP:       net.IP(append([]byte(nil), b[12:16]...)),
+			DestinationIP:  net.IP(append([]byte(nil), b[16:20]...)),
+			Options:        options,
+		},
+		Payload: append([]byte(nil), b[headerLength:totalLength]...),
+	}
+
+	if protocols.CalculateChecksum(b[:headerLength]) != 0 {
+		return p, errors.Wrapf(ErrInvalidChecksum, "checksum 0x%04x", p.Header.Checksum)
+	}
+	return p, nil
+}
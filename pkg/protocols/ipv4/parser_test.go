@@ -0,0 +1,195 @@
+package ipv4
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// an echo request from 192.0.2.1 to 192.0.2.2, with the Don't Fragment
+	// flag set
+	echoRequest = []byte{
+		0x45, 0x00, 0x00, 0x1c, 0x00, 0x01, 0x40, 0x00, 0x40, 0x01, 0xb6, 0xdc,
+		192, 0, 2, 1, 192, 0, 2, 2,
+		0x08, 0x00, 0xf7, 0xff, 0x00, 0x00, 0x00, 0x00,
+	}
+	// the same echo request carrying the Router Alert option
+	echoRequestWithOption = []byte{
+		0x46, 0x00, 0x00, 0x20, 0x00, 0x01, 0x40, 0x00, 0x40, 0x01, 0x21, 0xd4,
+		192, 0, 2, 1, 192, 0, 2, 2,
+		148, 4, 0, 0,
+		0x08, 0x00, 0xf7, 0xff, 0x00, 0x00, 0x00, 0x00,
+	}
+)
+
+// with returns a copy of b whose byte i is set to v.
+func with(b []byte, i int, v byte) []byte {
+	b = append([]byte(nil), b...)
+	b[i] = v
+	return b
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  []byte
+		want    *Packet
+		wantErr error
+	}{
+		{
+			name:   "echo request",
+			packet: echoRequest,
+			want: &Packet{
+				Header: &Header{
+					Version: 4, IHL: 5, TotalLength: 28, Identification: 1, Flags: FlagDontFragment,
+					TTL: 64, Protocol: 1, Checksum: 0xb6dc,
+					SourceIP: net.IP{192, 0, 2, 1}, DestinationIP: net.IP{192, 0, 2, 2},
+				},
+				Payload: echoRequest[20:],
+			},
+		},
+		{
+			name:   "options",
+			packet: echoRequestWithOption,
+			want: &Packet{
+				Header: &Header{
+					Version: 4, IHL: 6, TotalLength: 32, Identification: 1, Flags: FlagDontFragment,
+					TTL: 64, Protocol: 1, Checksum: 0x21d4,
+					SourceIP: net.IP{192, 0, 2, 1}, DestinationIP: net.IP{192, 0, 2, 2},
+					Options: []Option{&RouterAlertOption{}},
+				},
+				Payload: echoRequest[20:],
+			},
+		},
+		{
+			name:   "link layer padding",
+			packet: append(append([]byte(nil), echoRequest...), 0, 0, 0, 0),
+			want: &Packet{
+				Header: &Header{
+					Version: 4, IHL: 5, TotalLength: 28, Identification: 1, Flags: FlagDontFragment,
+					TTL: 64, Protocol: 1, Checksum: 0xb6dc,
+					SourceIP: net.IP{192, 0, 2, 1}, DestinationIP: net.IP{192, 0, 2, 2},
+				},
+				Payload: echoRequest[20:],
+			},
+		},
+		{name: "empty", packet: nil, wantErr: ErrTruncated},
+		{name: "truncated header", packet: echoRequest[:19], wantErr: ErrTruncated},
+		{name: "truncated options", packet: echoRequestWithOption[:22], wantErr: ErrTruncated},
+		{name: "truncated payload", packet: echoRequest[:27], wantErr: ErrTruncated},
+		{name: "IPv6", packet: with(echoRequest, 0, 0x65), wantErr: ErrMalformed},
+		{name: "header length too short", packet: with(echoRequest, 0, 0x44), wantErr: ErrMalformed},
+		{name: "total length too short", packet: with(echoRequest, 3, 19), wantErr: ErrMalformed},
+		{name: "option length past the header", packet: with(echoRequestWithOption, 21, 8), wantErr: ErrMalformed},
+		{name: "checksum", packet: with(echoRequest, 8, 63), wantErr: ErrInvalidChecksum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.packet)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, p)
+		})
+	}
+}
+
+func TestParseInvalidChecksumReturnsPacket(t *testing.T) {
+	// hosts recording themselves in Record Route options don't update the
+	// checksum
+	p, err := Parse(with(echoRequest, 8, 63))
+	assert.ErrorIs(t, err, ErrInvalidChecksum)
+	require.NotNil(t, p)
+	assert.Equal(t, uint8(63), p.Header.TTL)
+}
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []byte
+		want    []Option
+		wantErr bool
+	}{
+		{name: "padding", options: []byte{0, 0, 0, 0}},
+		{
+			name:    "no operation",
+			options: []byte{1, 148, 4, 0, 1, 0, 0, 0},
+			want:    []Option{&NoOperationOption{}, &RouterAlertOption{Value: 1}},
+		},
+		{
+			name:    "record route",
+			options: []byte{7, 11, 8, 192, 0, 2, 1, 0, 0, 0, 0, 0},
+			want: []Option{&RouteOption{
+				OptionType: OptionRecordRoute, Pointer: 8,
+				Addresses: []net.IP{{192, 0, 2, 1}, {0, 0, 0, 0}},
+			}},
+		},
+		{
+			name:    "loose source route",
+			options: []byte{131, 7, 4, 192, 0, 2, 9, 0},
+			want: []Option{&RouteOption{
+				OptionType: OptionLooseSourceRoute, Pointer: 4,
+				Addresses: []net.IP{{192, 0, 2, 9}},
+			}},
+		},
+		{
+			name:    "timestamps",
+			options: []byte{68, 12, 13, 0x00, 0, 0, 0, 1, 0, 0, 0, 2},
+			want: []Option{&TimestampOption{
+				Pointer: 13, Flag: TimestampOnly,
+				Entries: []TimestampEntry{{Timestamp: 1}, {Timestamp: 2}},
+			}},
+		},
+		{
+			name:    "timestamps and addresses",
+			options: []byte{68, 12, 5, 0x11, 192, 0, 2, 1, 0, 0, 0, 3},
+			want: []Option{&TimestampOption{
+				Pointer: 5, Overflow: 1, Flag: TimestampAndAddress,
+				Entries: []TimestampEntry{{Address: net.IP{192, 0, 2, 1}, Timestamp: 3}},
+			}},
+		},
+		{
+			name:    "unknown",
+			options: []byte{30, 4, 0xab, 0xcd},
+			want:    []Option{&UnknownOption{OptionType: 30, Data: []byte{0xab, 0xcd}}},
+		},
+		{name: "truncated", options: []byte{148}, wantErr: true},
+		{name: "length too short", options: []byte{148, 1, 0, 0}, wantErr: true},
+		{name: "length past the end", options: []byte{148, 8, 0, 0}, wantErr: true},
+		{name: "route of partial addresses", options: []byte{7, 5, 4, 1, 2, 0, 0, 0}, wantErr: true},
+		{name: "router alert length", options: []byte{148, 3, 0, 0}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := ParseOptions(tt.options)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, options)
+		})
+	}
+}
+
+func TestOptionsRoundTrip(t *testing.T) {
+	options := []Option{
+		&NoOperationOption{},
+		NewRecordRouteOption(2),
+		&RouterAlertOption{},
+	}
+	b, err := SerializeOptions(options)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 7, 11, 4, 0, 0, 0, 0, 0, 0, 0, 0, 148, 4, 0, 0}, b)
+
+	parsed, err := ParseOptions(b)
+	require.NoError(t, err)
+	assert.Equal(t, options, parsed)
+}
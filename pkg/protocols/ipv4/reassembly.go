@@ -0,0 +1,255 @@
+package ipv4
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OverlapPolicy tells which data a Reassembler keeps when fragments of a
+// datagram overlap.
+type OverlapPolicy uint8
+
+var (
+	// OverlapKeepFirst keeps the data that arrived first, as most BSD
+	// derived stacks do.
+	OverlapKeepFirst OverlapPolicy = 0
+	// OverlapKeepLast lets the data that arrived last overwrite earlier data.
+	OverlapKeepLast OverlapPolicy = 1
+	// OverlapDiscard drops the whole datagram as soon as two of its
+	// fragments overlap, as RFC 5722 requires of IPv6 and Linux does for
+	// IPv4.
+	OverlapDiscard OverlapPolicy = 2
+)
+
+var (
+	// ErrOverlap is returned when fragments overlap under OverlapDiscard.
+	ErrOverlap = errors.New("overlapping IPv4 fragments")
+	// ErrReassemblyLimit is returned when a fragment can't be held without
+	// going past the memory limit of the Reassembler.
+	ErrReassemblyLimit = errors.New("IPv4 reassembly memory limit exceeded")
+)
+
+// fragmentKey identifies the fragments of a datagram, as in RFC 791.
+type fragmentKey struct {
+	source      [4]byte
+	destination [4]byte
+	protocol    uint8
+	id          uint16
+}
+
+// fragmentData is a piece of a datagram, offset octets into its payload.
+type fragmentData struct {
+	offset int
+	data   []byte
+}
+
+// datagram holds the fragments of a datagram received so far.
+type datagram struct {
+	firstSeen time.Time
+	// header is the header of the first fragment, the only one that carries
+	// every option
+	header    *Header
+	fragments []fragmentData
+	// length is the size of the payload, known once the last fragment has
+	// been received, -1 until then
+	length int
+	size   int
+}
+
+// Reassembler rebuilds datagrams from their fragments. Incomplete datagrams
+// are dropped once they are older than the timeout, and the oldest ones are
+// dropped when the fragments held go past the memory limit.
+//
+// It is safe for concurrent use.
+type Reassembler struct {
+	timeout  time.Duration
+	maxBytes int
+	policy   OverlapPolicy
+
+	mu        sync.Mutex
+	datagrams map[fragmentKey]*datagram
+	size      int
+}
+
+// NewReassembler returns a Reassembler that holds the fragments of a datagram
+// for at most timeout, and at most maxBytes octets of fragments overall.
+func NewReassembler(timeout time.Duration, maxBytes int, policy OverlapPolicy) *Reassembler {
+	return &Reassembler{
+		timeout:   timeout,
+		maxBytes:  maxBytes,
+		policy:    policy,
+		datagrams: make(map[fragmentKey]*datagram),
+	}
+}
+
+// Add hands a received packet to the Reassembler. It returns the reassembled
+// datagram once its last missing fragment has been added, or nil while some
+// are still missing. Packets that aren't fragments are returned as is.
+func (r *Reassembler) Add(p *Packet) (*Packet, error) {
+	header := p.Header
+	if header.FragmentOffset == 0 && header.Flags&FlagMoreFragments == 0 {
+		return p, nil
+	}
+
+	offset := int(header.FragmentOffset) * fragmentUnit
+	end := offset + len(p.Payload)
+	more := header.Flags&FlagMoreFragments != 0
+	if more && len(p.Payload)%fragmentUnit != 0 {
+		return nil, errors.Wrapf(ErrMalformed, "fragment of %d bytes isn't a multiple of %d", len(p.Payload), fragmentUnit)
+	}
+	if HeaderSize+end > MaxPacketSize {
+		return nil, errors.Wrapf(ErrMalformed, "fragment ends past %d bytes", MaxPacketSize)
+	}
+	if len(p.Payload) > r.maxBytes {
+		return nil, errors.Wrapf(ErrReassemblyLimit, "fragment of %d bytes", len(p.Payload))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.expire(now)
+
+	key := fragmentKey{protocol: header.Protocol, id: header.Identification}
+	copy(key.source[:], header.SourceIP.To4())
+	copy(key.destination[:], header.DestinationIP.To4())
+	d, ok := r.datagrams[key]
+	if !ok {
+		d = &datagram{firstSeen: now, length: -1}
+		r.datagrams[key] = d
+	}
+
+	if !more {
+		if d.length >= 0 && d.length != end {
+			r.drop(key)
+			return nil, errors.Wrapf(ErrMalformed, "last fragments end at %d and %d", d.length, end)
+		}
+		// the fragments held so far must fit in the length now known
+		for _, f := range d.fragments {
+			if fragmentEnd := f.offset + len(f.data); fragmentEnd > end {
+				r.drop(key)
+				return nil, errors.Wrapf(ErrMalformed, "fragment ends at %d, past the end of the datagram at %d", fragmentEnd, end)
+			}
+		}
+		d.length = end
+	}
+	if d.length >= 0 && end > d.length {
+		r.drop(key)
+		return nil, errors.Wrapf(ErrMalformed, "fragment ends at %d, past the end of the datagram at %d", end, d.length)
+	}
+	if r.policy == OverlapDiscard {
+		for _, f := range d.fragments {
+			if offset < f.offset+len(f.data) && f.offset < end {
+				r.drop(key)
+				return nil, errors.Wrapf(ErrOverlap, "fragment %d-%d overlaps %d-%d", offset, end, f.offset, f.offset+len(f.data))
+			}
+		}
+	}
+	if offset == 0 && d.header == nil {
+		d.header = header
+	}
+
+	// make room by dropping the oldest incomplete datagrams
+	for r.size+len(p.Payload) > r.maxBytes {
+		oldest := r.oldest(key)
+		r.drop(oldest)
+		if oldest == key {
+			return nil, errors.Wrapf(ErrReassemblyLimit, "datagram of more than %d bytes", r.maxBytes)
+		}
+	}
+	d.fragments = append(d.fragments, fragmentData{offset: offset, data: p.Payload})
+	d.size += len(p.Payload)
+	r.size += len(p.Payload)
+
+	if !d.complete() {
+		return nil, nil
+	}
+	r.drop(key)
+	return d.reassemble(r.policy)
+}
+
+// Expire drops the incomplete datagrams that are older than the timeout, and
+// returns how many of them were dropped. Add expires datagrams on its own, it
+// is meant for callers that want memory back while no fragment is received.
+func (r *Reassembler) Expire() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.expire(time.Now())
+}
+
+func (r *Reassembler) expire(now time.Time) int {
+	n := 0
+	for key, d := range r.datagrams {
+		if now.Sub(d.firstSeen) >= r.timeout {
+			r.drop(key)
+			n++
+		}
+	}
+	return n
+}
+
+// oldest returns the key of the oldest datagram, other than keep unless it's
+// the only one left.
+func (r *Reassembler) oldest(keep fragmentKey) fragmentKey {
+	oldest := keep
+	var firstSeen time.Time
+	for key, d := range r.datagrams {
+		if key != keep && (firstSeen.IsZero() || d.firstSeen.Before(firstSeen)) {
+			oldest, firstSeen = key, d.firstSeen
+		}
+	}
+	return oldest
+}
+
+func (r *Reassembler) drop(key fragmentKey) {
+	if d, ok := r.datagrams[key]; ok {
+		r.size -= d.size
+		delete(r.datagrams, key)
+	}
+}
+
+// complete reports whether the fragments received cover the whole datagram.
+func (d *datagram) complete() bool {
+	if d.length < 0 || d.header == nil {
+		return false
+	}
+	fragments := append([]fragmentData(nil), d.fragments...)
+	sort.Slice(fragments, func(i, j int) bool { return fragments[i].offset < fragments[j].offset })
+	covered := 0
+	for _, f := range fragments {
+		if f.offset > covered {
+			return false
+		}
+		if end := f.offset + len(f.data); end > covered {
+			covered = end
+		}
+	}
+	return covered == d.length
+}
+
+// reassemble rebuilds the datagram from its fragments, resolving overlaps as
+// policy tells.
+func (d *datagram) reassemble(policy OverlapPolicy) (*Packet, error) {
+	payload := make([]byte, d.length)
+	if policy == OverlapKeepFirst {
+		// the data that arrived first is written last
+		for i := len(d.fragments) - 1; i >= 0; i-- {
+			copy(payload[d.fragments[i].offset:], d.fragments[i].data)
+		}
+	} else {
+		for _, f := range d.fragments {
+			copy(payload[f.offset:], f.data)
+		}
+	}
+
+	header := *d.header
+	header.Flags &^= FlagMoreFragments
+	header.FragmentOffset = 0
+	if err := header.updateLength(len(payload)); err != nil {
+		return nil, errors.Wrapf(err, "error creating reassembled datagram header")
+	}
+	return &Packet{Header: &header, Payload: payload}, nil
+}
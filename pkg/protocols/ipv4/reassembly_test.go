@@ -0,0 +1,232 @@
+package ipv4
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFragment returns a fragment of datagram id, offset octets into its
+// payload, holding data.
+func newFragment(t *testing.T, id uint16, offset int, more bool, data []byte) *Packet {
+	var flags uint8
+	if more {
+		flags = FlagMoreFragments
+	}
+	p, _, err := CreatePacket(4, 5, 0, flags, 64, 17, 0, id, uint16(offset/8), 0, net.IP{192, 0, 2, 1}, net.IP{192, 0, 2, 2}, data)
+	require.NoError(t, err)
+	return p
+}
+
+func TestReassemble(t *testing.T) {
+	p := newDatagram(t, 0, 100, NewSourceRouteOption(false, []net.IP{{198, 51, 100, 1}}), NewRecordRouteOption(2))
+	want, err := p.Serialize()
+	require.NoError(t, err)
+
+	fragments, err := Fragment(p, 64)
+	require.NoError(t, err)
+	require.Len(t, fragments, 4)
+
+	tests := []struct {
+		name   string
+		policy OverlapPolicy
+		order  []int
+	}{
+		{"in order", OverlapDiscard, []int{0, 1, 2, 3}},
+		{"reversed", OverlapDiscard, []int{3, 2, 1, 0}},
+		{"first fragment last", OverlapDiscard, []int{1, 3, 2, 0}},
+		{"duplicate", OverlapKeepFirst, []int{0, 1, 1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReassembler(time.Minute, 1<<16, tt.policy)
+
+			var reassembled *Packet
+			for i, n := range tt.order {
+				reassembled, err = r.Add(fragments[n])
+				require.NoError(t, err)
+				if i < len(tt.order)-1 {
+					assert.Nil(t, reassembled)
+				}
+			}
+			require.NotNil(t, reassembled)
+
+			b, err := reassembled.Serialize()
+			require.NoError(t, err)
+			assert.Equal(t, want, b)
+			// nothing is held once the datagram is complete
+			assert.Empty(t, r.datagrams)
+			assert.Zero(t, r.size)
+		})
+	}
+}
+
+func TestReassembleNotFragment(t *testing.T) {
+	r := NewReassembler(time.Minute, 1<<16, OverlapDiscard)
+	p := newDatagram(t, FlagDontFragment, 100)
+
+	got, err := r.Add(p)
+	require.NoError(t, err)
+	assert.Same(t, p, got)
+}
+
+func TestReassembleOverlap(t *testing.T) {
+	first := bytes.Repeat([]byte{'a'}, 16)
+	overlapping := bytes.Repeat([]byte{'b'}, 16)
+	last := bytes.Repeat([]byte{'c'}, 8)
+
+	tests := []struct {
+		policy  OverlapPolicy
+		want    []byte
+		wantErr error
+	}{
+		{policy: OverlapKeepFirst, want: []byte("aaaaaaaaaaaaaaaabbbbbbbbcccccccc")},
+		{policy: OverlapKeepLast, want: []byte("aaaaaaaabbbbbbbbbbbbbbbbcccccccc")},
+		{policy: OverlapDiscard, wantErr: ErrOverlap},
+	}
+
+	for _, tt := range tests {
+		r := NewReassembler(time.Minute, 1<<16, tt.policy)
+
+		got, err := r.Add(newFragment(t, 1, 0, true, first))
+		require.NoError(t, err)
+		require.Nil(t, got)
+
+		got, err = r.Add(newFragment(t, 1, 8, true, overlapping))
+		if tt.wantErr != nil {
+			assert.ErrorIs(t, err, tt.wantErr)
+			// the whole datagram is dropped
+			assert.Empty(t, r.datagrams)
+			assert.Zero(t, r.size)
+			continue
+		}
+		require.NoError(t, err)
+		require.Nil(t, got)
+
+		got, err = r.Add(newFragment(t, 1, 24, false, last))
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, tt.want, got.Payload)
+		assert.Equal(t, uint16(HeaderSize+32), got.Header.TotalLength)
+		assert.Zero(t, got.Header.Flags&FlagMoreFragments)
+	}
+}
+
+func TestReassembleTimeout(t *testing.T) {
+	r := NewReassembler(10*time.Millisecond, 1<<16, OverlapDiscard)
+
+	got, err := r.Add(newFragment(t, 1, 0, true, make([]byte, 8)))
+	require.NoError(t, err)
+	require.Nil(t, got)
+	assert.Equal(t, 0, r.Expire())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, r.Expire())
+	assert.Empty(t, r.datagrams)
+	assert.Zero(t, r.size)
+
+	// the first fragment is gone, the datagram can't be completed
+	got, err = r.Add(newFragment(t, 1, 8, false, make([]byte, 8)))
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestReassembleLimit(t *testing.T) {
+	r := NewReassembler(time.Minute, 32, OverlapDiscard)
+
+	_, err := r.Add(newFragment(t, 1, 0, true, make([]byte, 40)))
+	assert.ErrorIs(t, err, ErrReassemblyLimit)
+
+	_, err = r.Add(newFragment(t, 1, 0, true, make([]byte, 24)))
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+
+	// the oldest datagram makes room for the new one
+	_, err = r.Add(newFragment(t, 2, 0, true, make([]byte, 16)))
+	require.NoError(t, err)
+	assert.Len(t, r.datagrams, 1)
+	assert.Equal(t, 16, r.size)
+
+	got, err := r.Add(newFragment(t, 1, 24, false, make([]byte, 8)))
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	got, err = r.Add(newFragment(t, 2, 16, false, make([]byte, 8)))
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Len(t, got.Payload, 24)
+
+	// a datagram larger than the limit is dropped on its own
+	_, err = r.Add(newFragment(t, 3, 0, true, make([]byte, 24)))
+	require.NoError(t, err)
+	_, err = r.Add(newFragment(t, 3, 24, true, make([]byte, 16)))
+	assert.ErrorIs(t, err, ErrReassemblyLimit)
+	assert.Empty(t, r.datagrams)
+	assert.Zero(t, r.size)
+}
+
+func TestReassembleMalformed(t *testing.T) {
+	tests := []struct {
+		name      string
+		fragments []*Packet
+	}{
+		{
+			name:      "not a multiple of 8 octets",
+			fragments: []*Packet{newFragment(t, 1, 0, true, make([]byte, 12))},
+		},
+		{
+			name:      "past the largest datagram",
+			fragments: []*Packet{newFragment(t, 1, 65512, false, make([]byte, 8))},
+		},
+		{
+			name: "last fragments disagree",
+			fragments: []*Packet{
+				newFragment(t, 1, 16, false, make([]byte, 8)),
+				newFragment(t, 1, 8, false, make([]byte, 8)),
+			},
+		},
+		{
+			name: "past the last fragment",
+			fragments: []*Packet{
+				newFragment(t, 1, 16, false, make([]byte, 8)),
+				newFragment(t, 1, 24, true, make([]byte, 8)),
+			},
+		},
+		{
+			name: "past the last fragment received after it",
+			fragments: []*Packet{
+				newFragment(t, 1, 24, true, make([]byte, 8)),
+				newFragment(t, 1, 0, true, make([]byte, 8)),
+				newFragment(t, 1, 16, false, make([]byte, 8)),
+			},
+		},
+		{
+			name: "second last fragment ends elsewhere",
+			fragments: []*Packet{
+				newFragment(t, 1, 0, true, make([]byte, 8)),
+				newFragment(t, 1, 16, false, make([]byte, 8)),
+				newFragment(t, 1, 16, false, make([]byte, 16)),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReassembler(time.Minute, 1<<16, OverlapKeepLast)
+			var err error
+			for _, f := range tt.fragments {
+				if _, err = r.Add(f); err != nil {
+					break
+				}
+			}
+			assert.ErrorIs(t, err, ErrMalformed)
+			assert.Empty(t, r.datagrams)
+			assert.Zero(t, r.size)
+		})
+	}
+}
@@ -15,6 +15,12 @@ func (h *Header) Serialize() ([]byte, error) {
 	if err := protocols.WriteBinary(buf, versionIHL, h.TypeOfService, h.TotalLength, h.Identification, flagsAndOffset, h.TTL, h.Protocol, h.Checksum, h.SourceIP, h.DestinationIP); err != nil {
 		return nil, err
 	}
+
+	options, err := SerializeOptions(h.Options)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(options)
 	return buf.Bytes(), nil
 }
 
@@ -24,9 +30,8 @@ func (p *Packet) Serialize() ([]byte, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "error serializing IPv4 packet header")
 	}
-	buf.Write(p.Payload) // This feels wrong, but works
 	buf.Write(headerSerialized)
-	// buf.Write(p.Payload) // this feels right, but doesn't work
+	buf.Write(p.Payload)
 
 	return buf.Bytes(), nil
 }
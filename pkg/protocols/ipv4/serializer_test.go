@@ -0,0 +1,121 @@
+package ipv4
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePacket(t *testing.T) {
+	echo := echoRequest[20:]
+	// the UDP datagram from the checksum example of the IPv4 header article
+	// of Wikipedia, 192.168.0.1 to 192.168.0.199
+	udp := make([]byte, 0x73-20)
+	udpHeader := []byte{
+		0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11, 0xb8, 0x61,
+		0xc0, 0xa8, 0x00, 0x01, 0xc0, 0xa8, 0x00, 0xc7,
+	}
+
+	tests := []struct {
+		name     string
+		tos      uint8
+		flags    uint8
+		ttl      uint8
+		protocol uint8
+		id       uint16
+		offset   uint16
+		src      net.IP
+		dest     net.IP
+		payload  []byte
+		options  []Option
+		want     []byte
+	}{
+		{
+			name:  "echo request",
+			flags: FlagDontFragment, ttl: 64, protocol: 1, id: 1,
+			src: net.IP{192, 0, 2, 1}, dest: net.IP{192, 0, 2, 2},
+			payload: echo,
+			want:    echoRequest,
+		},
+		{
+			name:  "16 byte addresses",
+			flags: FlagDontFragment, ttl: 64, protocol: 1, id: 1,
+			src: net.IPv4(192, 0, 2, 1), dest: net.IPv4(192, 0, 2, 2),
+			payload: echo,
+			want:    echoRequest,
+		},
+		{
+			name:  "options",
+			flags: FlagDontFragment, ttl: 64, protocol: 1, id: 1,
+			src: net.IP{192, 0, 2, 1}, dest: net.IP{192, 0, 2, 2},
+			payload: echo,
+			options: []Option{&RouterAlertOption{}},
+			want:    echoRequestWithOption,
+		},
+		{
+			name:  "UDP",
+			flags: FlagDontFragment, ttl: 64, protocol: 17,
+			src: net.IP{192, 168, 0, 1}, dest: net.IP{192, 168, 0, 199},
+			payload: udp,
+			want:    append(append([]byte(nil), udpHeader...), udp...),
+		},
+		{
+			name: "fragment",
+			tos:  0xb8, flags: FlagMoreFragments, ttl: 1, protocol: 1, id: 0xbeef, offset: 0x1234,
+			src: net.IP{192, 0, 2, 1}, dest: net.IP{192, 0, 2, 2},
+			payload: []byte{0xde, 0xad, 0xbe, 0xef},
+			want: []byte{
+				0x45, 0xb8, 0x00, 0x18, 0xbe, 0xef, 0x32, 0x34, 0x01, 0x01, 0x44, 0x06,
+				192, 0, 2, 1, 192, 0, 2, 2,
+				0xde, 0xad, 0xbe, 0xef,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, b, err := CreatePacket(4, 5, tt.tos, tt.flags, tt.ttl, tt.protocol, 0, tt.id, tt.offset, 0, tt.src, tt.dest, tt.payload, tt.options...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, b)
+
+			serialized, err := p.Serialize()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, serialized)
+
+			// the header comes first
+			header, err := p.Header.Serialize()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want[:len(header)], header)
+			assert.Equal(t, tt.payload, serialized[len(header):])
+		})
+	}
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	for _, packet := range [][]byte{echoRequest, echoRequestWithOption} {
+		p, err := Parse(packet)
+		require.NoError(t, err)
+		b, err := p.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, packet, b)
+	}
+}
+
+func TestSerializeInvalidAddress(t *testing.T) {
+	h := &Header{Version: 4, IHL: 5, SourceIP: net.IP{1, 2, 3}, DestinationIP: net.IP{192, 0, 2, 2}}
+	_, err := h.Serialize()
+	assert.Error(t, err)
+}
+
+func TestCreatePacketTooLarge(t *testing.T) {
+	src, dest := net.IP{192, 0, 2, 1}, net.IP{192, 0, 2, 2}
+	_, b, err := CreatePacket(4, 5, 0, 0, 64, 1, 0, 1, 0, 0, src, dest, make([]byte, MaxPacketSize-HeaderSize))
+	require.NoError(t, err)
+	assert.Len(t, b, MaxPacketSize)
+
+	// the total length would wrap around
+	_, _, err = CreatePacket(4, 5, 0, 0, 64, 1, 0, 1, 0, 0, src, dest, make([]byte, MaxPacketSize-HeaderSize+1))
+	assert.Error(t, err)
+}
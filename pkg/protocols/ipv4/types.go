@@ -2,6 +2,12 @@ package ipv4
 
 import "net"
 
+var (
+	// Flags of the IPv4 header, the most significant of the 3 bits is reserved
+	FlagDontFragment  uint8 = 0x2
+	FlagMoreFragments uint8 = 0x1
+)
+
 // Header represents the header of an IPv4 Packet.
 // This struct defines the fields that make up the IPv4 packet header,
 type Header struct {
@@ -19,6 +25,9 @@ type Header struct {
 	Checksum      uint16
 	SourceIP      net.IP
 	DestinationIP net.IP
+	// Options follow the destination address, padded to a multiple of 4
+	// bytes. IHL has to account for them.
+	Options []Option
 }
 
 // Packet represents an IPv4 packet.
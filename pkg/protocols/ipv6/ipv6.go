@@ -0,0 +1,64 @@
+package ipv6
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+var (
+	Version uint8 = 6
+	// HeaderSize is the size of the fixed IPv6 header, in octets
+	HeaderSize = 40
+	// MaxPayloadSize is the largest payload the payload length can describe,
+	// jumbograms aside
+	MaxPayloadSize = 65535
+)
+
+func CreatePacket(
+	trafficClass,
+	nextHeader,
+	hopLimit uint8,
+	flowLabel uint32,
+	src,
+	dest net.IP,
+	payload []byte,
+) (*Packet, []byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, nil, errors.Errorf("payload of %d bytes too large, at most %d fit in the payload length", len(payload), MaxPayloadSize)
+	}
+	p := &Packet{
+		Header: &Header{
+			Version:       Version,
+			TrafficClass:  trafficClass,
+			FlowLabel:     flowLabel,
+			PayloadLength: uint16(len(payload)),
+			NextHeader:    nextHeader,
+			HopLimit:      hopLimit,
+			SourceIP:      src,
+			DestinationIP: dest,
+		},
+		Payload: payload,
+	}
+
+	packetSerialized, err := p.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing ip packet")
+	}
+
+	return p, packetSerialized, nil
+}
+
+// PseudoHeaderChecksum calculates the checksum of an upper-layer packet, such
+// as ICMPv6, UDP or TCP, carried over IPv6. IPv6 has no header checksum, so
+// the upper-layer checksum covers a pseudo-header made of the source and
+// destination addresses, the upper-layer packet length and the next header
+// value, as described in RFC 8200, section 8.1.
+func PseudoHeaderChecksum(src, dest net.IP, nextHeader uint8, payload []byte) (uint16, error) {
+	// IPv4 addresses would get the IPv4 pseudo-header
+	if src.To16() == nil || dest.To16() == nil || src.To4() != nil || dest.To4() != nil {
+		return 0, errors.Errorf("invalid IPv6 address pair %v, %v", src, dest)
+	}
+	return protocols.Checksum(src, dest, nextHeader, payload)
+}
@@ -0,0 +1,35 @@
+package ipv6
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+func (h *Header) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	versionClassFlow := uint32(h.Version)<<28 | uint32(h.TrafficClass)<<20 | h.FlowLabel&0xfffff
+
+	src, dest := h.SourceIP.To16(), h.DestinationIP.To16()
+	if src == nil || dest == nil {
+		return nil, errors.Errorf("invalid IPv6 address pair %v, %v", h.SourceIP, h.DestinationIP)
+	}
+
+	if err := protocols.WriteBinary(buf, versionClassFlow, h.PayloadLength, h.NextHeader, h.HopLimit, []byte(src), []byte(dest)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *Packet) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	headerSerialized, err := p.Header.Serialize()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error serializing IPv6 packet header")
+	}
+	buf.Write(headerSerialized)
+	buf.Write(p.Payload)
+
+	return buf.Bytes(), nil
+}
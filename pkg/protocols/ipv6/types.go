@@ -0,0 +1,26 @@
+package ipv6
+
+import "net"
+
+// Header represents the fixed header of an IPv6 packet.
+// Unlike IPv4, the header has a fixed size of 40 bytes and carries no checksum.
+type Header struct {
+	Version      uint8
+	TrafficClass uint8
+	// FlowLabel is a 20 bit field, only the lower 20 bits are serialized
+	FlowLabel uint32
+	// PayloadLength is the length of the data following the header, in octets
+	PayloadLength uint16
+	// NextHeader identifies the type of header following the IPv6 header,
+	// and uses the same values as the IPv4 Protocol field
+	NextHeader    uint8
+	HopLimit      uint8
+	SourceIP      net.IP
+	DestinationIP net.IP
+}
+
+// Packet represents an IPv6 packet.
+type Packet struct {
+	Header  *Header
+	Payload []byte
+}
@@ -0,0 +1,276 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Option kinds, as registered by IANA
+	OptionEndOfList     uint8 = 0
+	OptionNoOperation   uint8 = 1
+	OptionMSS           uint8 = 2
+	OptionWindowScale   uint8 = 3
+	OptionSACKPermitted uint8 = 4
+	OptionSACK          uint8 = 5
+	OptionTimestamps    uint8 = 8
+
+	// MaxOptionsSize is the room left for options by the largest data
+	// offset, 15 words
+	MaxOptionsSize = 40
+	// MaxWindowScale is the largest shift of the window, which keeps it
+	// below 2^30 (RFC 7323, section 2.3)
+	MaxWindowScale uint8 = 14
+	// MaxSACKBlocks is the number of SACK blocks that fit in the options
+	MaxSACKBlocks = 4
+)
+
+var (
+	mssOptionSize           uint8 = 4
+	windowScaleOptionSize   uint8 = 3
+	sackPermittedOptionSize uint8 = 2
+	timestampsOptionSize    uint8 = 10
+	// a SACK option holds its kind and length octets, then blocks made of
+	// two sequence numbers
+	sackBlockSize = 8
+)
+
+// Option is a TCP header option.
+type Option interface {
+	// Type returns the option kind, eg: OptionMSS.
+	Type() uint8
+	// Serialize returns the option as it appears in the header, kind and
+	// length octets included.
+	Serialize() ([]byte, error)
+}
+
+// MSSOption announces the largest segment the sender is willing to receive
+// (RFC 9293, section 3.7.1). It is only sent in SYN segments.
+type MSSOption struct {
+	MSS uint16
+}
+
+func (o *MSSOption) Type() uint8 {
+	return OptionMSS
+}
+
+func (o *MSSOption) Serialize() ([]byte, error) {
+	b := []byte{OptionMSS, mssOptionSize, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], o.MSS)
+	return b, nil
+}
+
+// WindowScaleOption announces that the windows sent by the sender are to be
+// shifted left by Shift bits (RFC 7323). It is only sent in SYN segments. A
+// shift above MaxWindowScale is read as MaxWindowScale, as the RFC requires.
+type WindowScaleOption struct {
+	Shift uint8
+}
+
+func (o *WindowScaleOption) Type() uint8 {
+	return OptionWindowScale
+}
+
+func (o *WindowScaleOption) Serialize() ([]byte, error) {
+	return []byte{OptionWindowScale, windowScaleOptionSize, o.Shift}, nil
+}
+
+// SACKPermittedOption announces that the sender supports selective
+// acknowledgments (RFC 2018). It is only sent in SYN segments.
+type SACKPermittedOption struct{}
+
+func (o *SACKPermittedOption) Type() uint8 {
+	return OptionSACKPermitted
+}
+
+func (o *SACKPermittedOption) Serialize() ([]byte, error) {
+	return []byte{OptionSACKPermitted, sackPermittedOptionSize}, nil
+}
+
+// SACKBlock is a block of data received out of order, from the sequence
+// number Left up to, but not including, Right.
+type SACKBlock struct {
+	Left  uint32
+	Right uint32
+}
+
+// SACKOption acknowledges blocks of data received out of order (RFC 2018). It
+// holds from 1 to MaxSACKBlocks blocks, fewer when other options are sent.
+type SACKOption struct {
+	Blocks []SACKBlock
+}
+
+func (o *SACKOption) Type() uint8 {
+	return OptionSACK
+}
+
+func (o *SACKOption) Serialize() ([]byte, error) {
+	if len(o.Blocks) == 0 || len(o.Blocks) > MaxSACKBlocks {
+		return nil, errors.Errorf("SACK option can't hold %d blocks", len(o.Blocks))
+	}
+	length := 2 + sackBlockSize*len(o.Blocks)
+
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{OptionSACK, uint8(length)})
+	for _, block := range o.Blocks {
+		if err := binary.Write(buf, binary.BigEndian, block); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// TimestampsOption carries the timestamp clock of the sender, and echoes the
+// latest timestamp received from the peer (RFC 7323).
+type TimestampsOption struct {
+	Value     uint32
+	EchoReply uint32
+}
+
+func (o *TimestampsOption) Type() uint8 {
+	return OptionTimestamps
+}
+
+func (o *TimestampsOption) Serialize() ([]byte, error) {
+	b := make([]byte, timestampsOptionSize)
+	b[0], b[1] = OptionTimestamps, timestampsOptionSize
+	binary.BigEndian.PutUint32(b[2:6], o.Value)
+	binary.BigEndian.PutUint32(b[6:10], o.EchoReply)
+	return b, nil
+}
+
+// NoOperationOption is a single octet used between options, eg: to align the
+// next option on a 32 bit boundary. Unlike the other options, it has no
+// length octet.
+type NoOperationOption struct{}
+
+func (o *NoOperationOption) Type() uint8 {
+	return OptionNoOperation
+}
+
+func (o *NoOperationOption) Serialize() ([]byte, error) {
+	return []byte{OptionNoOperation}, nil
+}
+
+// UnknownOption holds an option of a kind that isn't decoded.
+type UnknownOption struct {
+	OptionType uint8
+	// Data holds the option, past its kind and length octets.
+	Data []byte
+}
+
+func (o *UnknownOption) Type() uint8 {
+	return o.OptionType
+}
+
+func (o *UnknownOption) Serialize() ([]byte, error) {
+	if len(o.Data)+2 > MaxOptionsSize {
+		return nil, errors.Errorf("option of kind %d too long: %d bytes", o.OptionType, len(o.Data))
+	}
+	return append([]byte{o.OptionType, uint8(len(o.Data) + 2)}, o.Data...), nil
+}
+
+// SerializeOptions returns options as they appear in the header, padded with
+// End of Option List octets to a multiple of 4 bytes, as the data offset is
+// counted in 32 bit words.
+func SerializeOptions(options []Option) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for _, o := range options {
+		b, err := o.Serialize()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error serializing TCP option %d", o.Type())
+		}
+		buf.Write(b)
+	}
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(OptionEndOfList)
+	}
+
+	if buf.Len() > MaxOptionsSize {
+		return nil, errors.Errorf("TCP options too long: %d bytes, at most %d fit in the header", buf.Len(), MaxOptionsSize)
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseOptions decodes the options of a TCP header, i.e. the bytes that
+// follow its first 20 bytes up to the data offset. End of Option List and
+// No-Operation are single octets, every other option starts with its kind and
+// its length, which counts both. Options stop at End of Option List, the
+// octets that follow it being padding; options of an unknown kind are kept as
+// UnknownOption.
+func ParseOptions(b []byte) ([]Option, error) {
+	var options []Option
+	for i := 0; i < len(b); {
+		kind := b[i]
+		if kind == OptionEndOfList {
+			break
+		}
+		if kind == OptionNoOperation {
+			options = append(options, &NoOperationOption{})
+			i++
+			continue
+		}
+
+		if i+2 > len(b) {
+			return nil, errors.Errorf("truncated TCP option %d", kind)
+		}
+		length := int(b[i+1])
+		if length < 2 || i+length > len(b) {
+			return nil, errors.Errorf("invalid length %d of TCP option %d", length, kind)
+		}
+		o, err := parseOption(kind, b[i:i+length])
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, o)
+		i += length
+	}
+	return options, nil
+}
+
+func parseOption(kind uint8, b []byte) (Option, error) {
+	// options of a fixed size
+	sizes := map[uint8]uint8{
+		OptionMSS:           mssOptionSize,
+		OptionWindowScale:   windowScaleOptionSize,
+		OptionSACKPermitted: sackPermittedOptionSize,
+		OptionTimestamps:    timestampsOptionSize,
+	}
+	if size, ok := sizes[kind]; ok && len(b) != int(size) {
+		return nil, errors.Errorf("invalid length %d of TCP option %d", len(b), kind)
+	}
+
+	switch kind {
+	case OptionMSS:
+		return &MSSOption{MSS: binary.BigEndian.Uint16(b[2:4])}, nil
+	case OptionWindowScale:
+		shift := b[2]
+		if shift > MaxWindowScale {
+			shift = MaxWindowScale
+		}
+		return &WindowScaleOption{Shift: shift}, nil
+	case OptionSACKPermitted:
+		return &SACKPermittedOption{}, nil
+	case OptionTimestamps:
+		return &TimestampsOption{
+			Value:     binary.BigEndian.Uint32(b[2:6]),
+			EchoReply: binary.BigEndian.Uint32(b[6:10]),
+		}, nil
+	case OptionSACK:
+		if len(b) == 2 || (len(b)-2)%sackBlockSize != 0 {
+			return nil, errors.Errorf("invalid length %d of TCP SACK option", len(b))
+		}
+		o := &SACKOption{}
+		for i := 2; i < len(b); i += sackBlockSize {
+			o.Blocks = append(o.Blocks, SACKBlock{
+				Left:  binary.BigEndian.Uint32(b[i : i+4]),
+				Right: binary.BigEndian.Uint32(b[i+4 : i+8]),
+			})
+		}
+		return o, nil
+	}
+
+	return &UnknownOption{OptionType: kind, Data: append([]byte(nil), b[2:]...)}, nil
+}
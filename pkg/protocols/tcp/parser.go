@@ -0,0 +1,72 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+var (
+	// ErrTruncated is returned when the input is shorter than the fixed
+	// header, or than the header length given by the data offset.
+	ErrTruncated = errors.New("truncated TCP segment")
+	// ErrMalformed is returned when the data offset is below 5 words, or
+	// when the options don't follow RFC 9293, section 3.1.
+	ErrMalformed = errors.New("malformed TCP segment")
+	// ErrInvalidChecksum is returned when the checksum doesn't match.
+	ErrInvalidChecksum = errors.New("invalid TCP checksum")
+)
+
+// Parse decodes a TCP segment, starting at its header, options included. TCP
+// has no length field of its own: the segment runs up to the end of b, which
+// the caller cuts to the length given by the IP layer.
+//
+// The checksum is verified over the pseudo-header when both src and dest are
+// given. Every TCP segment carries one, a zero checksum isn't exempted as it
+// is for UDP over IPv4.
+//
+// Errors wrap ErrTruncated, ErrMalformed or ErrInvalidChecksum.
+func Parse(b []byte, src, dest net.IP) (*Packet, error) {
+	if len(b) < HeaderSize {
+		return nil, errors.Wrapf(ErrTruncated, "%d bytes, header needs %d", len(b), HeaderSize)
+	}
+	h := &Header{
+		SourcePort:           binary.BigEndian.Uint16(b[0:2]),
+		DestinationPort:      binary.BigEndian.Uint16(b[2:4]),
+		SequenceNumber:       binary.BigEndian.Uint32(b[4:8]),
+		AcknowledgmentNumber: binary.BigEndian.Uint32(b[8:12]),
+		DataOffset:           b[12] >> 4,
+		Flags:                b[13],
+		Window:               binary.BigEndian.Uint16(b[14:16]),
+		Checksum:             binary.BigEndian.Uint16(b[16:18]),
+		UrgentPointer:        binary.BigEndian.Uint16(b[18:20]),
+	}
+
+	headerLength := int(h.DataOffset) * 4
+	if headerLength < HeaderSize {
+		return nil, errors.Wrapf(ErrMalformed, "data offset %d", h.DataOffset)
+	}
+	if headerLength > len(b) {
+		return nil, errors.Wrapf(ErrTruncated, "%d bytes, header length is %d", len(b), headerLength)
+	}
+
+	if src != nil && dest != nil {
+		checksum, err := protocols.Checksum(src, dest, ProtocolNumber, b)
+		if err != nil {
+			return nil, err
+		}
+		if checksum != 0 {
+			return nil, errors.Wrapf(ErrInvalidChecksum, "checksum 0x%04x", h.Checksum)
+		}
+	}
+
+	options, err := ParseOptions(b[HeaderSize:headerLength])
+	if err != nil {
+		return nil, errors.Wrapf(ErrMalformed, "%v", err)
+	}
+	h.Options = options
+
+	return &Packet{Header: h, Payload: b[headerLength:]}, nil
+}
@@ -0,0 +1,35 @@
+package tcp
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+func (h *Header) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	// the 4 bits that follow the data offset are reserved
+	if err := protocols.WriteBinary(buf, h.SourcePort, h.DestinationPort, h.SequenceNumber, h.AcknowledgmentNumber, h.DataOffset<<4, h.Flags, h.Window, h.Checksum, h.UrgentPointer); err != nil {
+		return nil, err
+	}
+
+	options, err := SerializeOptions(h.Options)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(options)
+	return buf.Bytes(), nil
+}
+
+func (p *Packet) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	headerSerialized, err := p.Header.Serialize()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error serializing TCP header")
+	}
+	buf.Write(headerSerialized)
+	buf.Write(p.Payload)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,84 @@
+package tcp
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+// CreatePacket creates a TCP segment from srcPort to destPort, with the
+// sequence and acknowledgment numbers, control bits and receive window given.
+// The data offset is derived from the options, padded to a 32 bit boundary.
+// The checksum covers the pseudo-header of src and dest, then the segment.
+func CreatePacket(
+	srcPort,
+	destPort uint16,
+	seq,
+	ack uint32,
+	flags uint8,
+	window uint16,
+	src,
+	dest net.IP,
+	payload []byte,
+	options ...Option,
+) (*Packet, []byte, error) {
+	optionsSerialized, err := SerializeOptions(options)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error calculating data offset of segment")
+	}
+	p := &Packet{
+		Header: &Header{
+			SourcePort:           srcPort,
+			DestinationPort:      destPort,
+			SequenceNumber:       seq,
+			AcknowledgmentNumber: ack,
+			DataOffset:           uint8((HeaderSize + len(optionsSerialized)) / 4),
+			Flags:                flags,
+			Window:               window,
+			Options:              options,
+		},
+		Payload: payload,
+	}
+
+	packetSerialized, err := p.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing TCP packet")
+	}
+	p.Header.Checksum, err = protocols.Checksum(src, dest, ProtocolNumber, packetSerialized)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error calculating TCP checksum")
+	}
+
+	packetSerialized, err = p.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing TCP packet")
+	}
+
+	return p, packetSerialized, nil
+}
+
+// HasFlags reports whether every control bit of flags is set in h, eg:
+// h.HasFlags(FlagSYN | FlagACK) for the answer to a SYN probe.
+func (h *Header) HasFlags(flags uint8) bool {
+	return h.Flags&flags == flags
+}
+
+// FlagsString returns the names of the control bits set in h, eg: "SYN,ACK".
+func (h *Header) FlagsString() string {
+	names := []struct {
+		flag uint8
+		name string
+	}{
+		{FlagFIN, "FIN"}, {FlagSYN, "SYN"}, {FlagRST, "RST"}, {FlagPSH, "PSH"},
+		{FlagACK, "ACK"}, {FlagURG, "URG"}, {FlagECE, "ECE"}, {FlagCWR, "CWR"},
+	}
+	var set []string
+	for _, n := range names {
+		if h.Flags&n.flag != 0 {
+			set = append(set, n.name)
+		}
+	}
+	return strings.Join(set, ",")
+}
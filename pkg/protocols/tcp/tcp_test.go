@@ -0,0 +1,218 @@
+package tcp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+var (
+	src, dest     = net.IP{192, 0, 2, 1}, net.IP{192, 0, 2, 2}
+	srcV6, destV6 = net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+
+	// the options of a SYN sent by Linux
+	synOptions = []Option{
+		&MSSOption{MSS: 1460},
+		&SACKPermittedOption{},
+		&TimestampsOption{Value: 1},
+		&NoOperationOption{},
+		&WindowScaleOption{Shift: 7},
+	}
+	// a SYN from port 40000 to port 80 carrying synOptions, over IPv4
+	syn = []byte{
+		0x9c, 0x40, 0x00, 0x50, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0xa0, 0x02, 0xff, 0xff, 0x27, 0x6a, 0x00, 0x00,
+		0x02, 0x04, 0x05, 0xb4, 0x04, 0x02, 0x08, 0x0a, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x01, 0x03, 0x03, 0x07,
+	}
+)
+
+func TestCreatePacket(t *testing.T) {
+	// the same SYN over IPv6 only differs by its checksum
+	synV6 := append([]byte(nil), syn...)
+	synV6[16], synV6[17] = 0x4f, 0xf9
+
+	tests := []struct {
+		name    string
+		flags   uint8
+		ack     uint32
+		src     net.IP
+		dest    net.IP
+		payload []byte
+		options []Option
+		want    []byte
+	}{
+		{name: "SYN", flags: FlagSYN, src: src, dest: dest, options: synOptions, want: syn},
+		{name: "SYN over IPv6", flags: FlagSYN, src: srcV6, dest: destV6, options: synOptions, want: synV6},
+		{
+			name: "data", flags: FlagPSH | FlagACK, ack: 2, src: src, dest: dest, payload: []byte("hi"),
+			want: []byte{
+				0x9c, 0x40, 0x00, 0x50, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02,
+				0x50, 0x18, 0xff, 0xff, 0x26, 0xca, 0x00, 0x00,
+				'h', 'i',
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, b, err := CreatePacket(40000, 80, 1, tt.ack, tt.flags, 0xffff, tt.src, tt.dest, tt.payload, tt.options...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, b)
+			assert.Equal(t, tt.want[12]>>4, p.Header.DataOffset)
+
+			checksum, err := protocols.Checksum(tt.src, tt.dest, ProtocolNumber, b)
+			require.NoError(t, err)
+			assert.Zero(t, checksum)
+		})
+	}
+}
+
+func TestCreatePacketOptionsTooLong(t *testing.T) {
+	_, _, err := CreatePacket(40000, 80, 1, 0, FlagSYN, 0xffff, src, dest, nil, &UnknownOption{OptionType: 254, Data: make([]byte, 39)})
+	assert.Error(t, err)
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse(syn, src, dest)
+	require.NoError(t, err)
+	assert.Equal(t, &Header{
+		SourcePort: 40000, DestinationPort: 80, SequenceNumber: 1,
+		DataOffset: 10, Flags: FlagSYN, Window: 0xffff, Checksum: 0x276a,
+		Options: synOptions,
+	}, p.Header)
+	assert.Empty(t, p.Payload)
+	assert.True(t, p.Header.HasFlags(FlagSYN))
+	assert.False(t, p.Header.HasFlags(FlagSYN|FlagACK))
+	assert.Equal(t, "SYN", p.Header.FlagsString())
+
+	// it serializes back to the segment
+	b, err := p.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, syn, b)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		segment []byte
+		src     net.IP
+		dest    net.IP
+		wantErr error
+	}{
+		{name: "truncated header", segment: syn[:19], wantErr: ErrTruncated},
+		{name: "truncated options", segment: syn[:39], wantErr: ErrTruncated},
+		{name: "data offset too small", segment: append([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x40}, make([]byte, 7)...), wantErr: ErrMalformed},
+		{name: "wrong addresses", segment: syn, src: src, dest: net.IP{192, 0, 2, 3}, wantErr: ErrInvalidChecksum},
+		{name: "IPv4 checksum over IPv6", segment: syn, src: srcV6, dest: destV6, wantErr: ErrInvalidChecksum},
+		{
+			name: "invalid option",
+			segment: []byte{
+				0x9c, 0x40, 0x00, 0x50, 0, 0, 0, 1, 0, 0, 0, 0, 0x60, 0x02, 0xff, 0xff, 0, 0, 0, 0,
+				OptionMSS, 3, 5, 0,
+			},
+			wantErr: ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.segment, tt.src, tt.dest)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestOptionsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		want    []byte
+	}{
+		{name: "none", want: nil},
+		{name: "MSS", options: []Option{&MSSOption{MSS: 536}}, want: []byte{2, 4, 0x02, 0x18}},
+		{name: "window scale padded", options: []Option{&WindowScaleOption{Shift: 14}}, want: []byte{3, 3, 14, 0}},
+		{
+			name:    "SACK",
+			options: []Option{&NoOperationOption{}, &NoOperationOption{}, &SACKOption{Blocks: []SACKBlock{{Left: 1, Right: 2}}}},
+			want:    []byte{1, 1, 5, 10, 0, 0, 0, 1, 0, 0, 0, 2},
+		},
+		{name: "unknown", options: []Option{&UnknownOption{OptionType: 30, Data: []byte{1, 2}}}, want: []byte{30, 4, 1, 2}},
+		{name: "SYN", options: synOptions, want: syn[HeaderSize:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := SerializeOptions(tt.options)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, b)
+
+			options, err := ParseOptions(b)
+			require.NoError(t, err)
+			assert.Equal(t, tt.options, options)
+		})
+	}
+}
+
+func TestParseOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []byte
+	}{
+		{"missing length", []byte{OptionMSS}},
+		{"length too small", []byte{30, 1, 0, 0}},
+		{"past the end", []byte{30, 8, 0, 0}},
+		{"wrong MSS length", []byte{OptionMSS, 3, 0, 0}},
+		{"partial SACK block", []byte{OptionSACK, 6, 0, 0, 0, 1}},
+		{"SACK without blocks", []byte{OptionSACK, 2}},
+		{"wrong timestamps length", []byte{OptionTimestamps, 6, 0, 0, 0, 1}},
+		{"wrong SACK permitted length", []byte{OptionSACKPermitted, 3, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseOptions(tt.options)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []byte
+		want    []Option
+	}{
+		// the octets past End of Option List are padding, whatever they hold
+		{"end of list", []byte{OptionNoOperation, OptionEndOfList, OptionMSS, 0}, []Option{&NoOperationOption{}}},
+		{"window scale above the limit", []byte{OptionWindowScale, 3, 15, OptionEndOfList}, []Option{&WindowScaleOption{Shift: 14}}},
+		{
+			name:    "four SACK blocks",
+			options: append([]byte{OptionNoOperation, OptionNoOperation, OptionSACK, 34}, make([]byte, 32)...),
+			want:    []Option{&NoOperationOption{}, &NoOperationOption{}, &SACKOption{Blocks: make([]SACKBlock, 4)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := ParseOptions(tt.options)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, options)
+		})
+	}
+}
+
+func TestSerializeOptionsTooLong(t *testing.T) {
+	blocks := make([]SACKBlock, 4)
+	_, err := SerializeOptions([]Option{&TimestampsOption{}, &SACKOption{Blocks: blocks}})
+	assert.Error(t, err)
+
+	_, err = SerializeOptions([]Option{&SACKOption{Blocks: make([]SACKBlock, 5)}})
+	assert.Error(t, err)
+
+	_, err = SerializeOptions([]Option{&SACKOption{}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package tcp
+
+var (
+	// ProtocolNumber is the value of the IPv4 protocol and IPv6 next header
+	// fields for TCP
+	ProtocolNumber uint8 = 6
+	// HeaderSize is the size of a TCP header without options, in octets
+	HeaderSize = 20
+
+	// Control bits of the TCP header, as defined in RFC 9293 and RFC 3168
+	FlagFIN uint8 = 0x01
+	FlagSYN uint8 = 0x02
+	FlagRST uint8 = 0x04
+	FlagPSH uint8 = 0x08
+	FlagACK uint8 = 0x10
+	FlagURG uint8 = 0x20
+	FlagECE uint8 = 0x40
+	FlagCWR uint8 = 0x80
+)
+
+// Header represents the header of a TCP segment.
+type Header struct {
+	SourcePort           uint16
+	DestinationPort      uint16
+	SequenceNumber       uint32
+	AcknowledgmentNumber uint32
+	// DataOffset is the length of the header, options included, in 32 bit
+	// words
+	DataOffset    uint8
+	Flags         uint8
+	Window        uint16
+	Checksum      uint16
+	UrgentPointer uint16
+	// Options follow the urgent pointer, padded to a multiple of 4 bytes.
+	// DataOffset has to account for them.
+	Options []Option
+}
+
+// Packet represents a TCP segment.
+type Packet struct {
+	Header  *Header
+	Payload []byte
+}
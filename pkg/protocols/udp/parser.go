@@ -0,0 +1,61 @@
+package udp
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+var (
+	// ErrTruncated is returned when the input is shorter than the header, or
+	// than the length it announces.
+	ErrTruncated = errors.New("truncated UDP datagram")
+	// ErrMalformed is returned when the length field is impossible.
+	ErrMalformed = errors.New("malformed UDP datagram")
+	// ErrInvalidChecksum is returned when the checksum doesn't match.
+	ErrInvalidChecksum = errors.New("invalid UDP checksum")
+)
+
+// Parse decodes a UDP datagram, starting at its header. Bytes past the length
+// announced by the header are ignored.
+//
+// The checksum is only verified when both src and dest, the addresses of the
+// IP layer, are given. A zero checksum over IPv4 means that the sender didn't
+// compute one, it isn't verified either.
+//
+// Errors wrap ErrTruncated, ErrMalformed or ErrInvalidChecksum.
+func Parse(b []byte, src, dest net.IP) (*Packet, error) {
+	if len(b) < HeaderSize {
+		return nil, errors.Wrapf(ErrTruncated, "%d bytes, header needs %d", len(b), HeaderSize)
+	}
+	h := &Header{
+		SourcePort:      binary.BigEndian.Uint16(b[0:2]),
+		DestinationPort: binary.BigEndian.Uint16(b[2:4]),
+		Length:          binary.BigEndian.Uint16(b[4:6]),
+		Checksum:        binary.BigEndian.Uint16(b[6:8]),
+	}
+
+	length := int(h.Length)
+	if length < HeaderSize {
+		return nil, errors.Wrapf(ErrMalformed, "length %d", length)
+	}
+	if length > len(b) {
+		return nil, errors.Wrapf(ErrTruncated, "%d bytes, length is %d", len(b), length)
+	}
+	b = b[:length]
+
+	overIPv4 := src.To4() != nil && dest.To4() != nil
+	if src != nil && dest != nil && !(overIPv4 && h.Checksum == 0) {
+		checksum, err := protocols.Checksum(src, dest, ProtocolNumber, b)
+		if err != nil {
+			return nil, err
+		}
+		if checksum != 0 {
+			return nil, errors.Wrapf(ErrInvalidChecksum, "checksum 0x%04x", h.Checksum)
+		}
+	}
+
+	return &Packet{Header: h, Payload: b[HeaderSize:]}, nil
+}
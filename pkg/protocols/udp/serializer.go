@@ -0,0 +1,28 @@
+package udp
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+func (h *Header) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := protocols.WriteBinary(buf, h.SourcePort, h.DestinationPort, h.Length, h.Checksum); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *Packet) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	headerSerialized, err := p.Header.Serialize()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error serializing UDP header")
+	}
+	buf.Write(headerSerialized)
+	buf.Write(p.Payload)
+
+	return buf.Bytes(), nil
+}
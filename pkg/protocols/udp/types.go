@@ -0,0 +1,27 @@
+package udp
+
+var (
+	// ProtocolNumber is the value of the IPv4 protocol and IPv6 next header
+	// fields for UDP
+	ProtocolNumber uint8 = 17
+	// HeaderSize is the size of the UDP header, in octets
+	HeaderSize = 8
+)
+
+// Header represents the header of a UDP datagram, as defined in RFC 768.
+type Header struct {
+	SourcePort      uint16
+	DestinationPort uint16
+	// Length is the length of the datagram, header included
+	Length uint16
+	// Checksum covers a pseudo-header of the IP layer, the header and the
+	// data. Zero means that no checksum was computed, which is only allowed
+	// over IPv4.
+	Checksum uint16
+}
+
+// Packet represents a UDP datagram.
+type Packet struct {
+	Header  *Header
+	Payload []byte
+}
@@ -0,0 +1,54 @@
+package udp
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+// CreatePacket creates a UDP datagram from src to dest carrying payload. The
+// length and the checksum, which covers a pseudo-header of the IPv4 or IPv6
+// layer depending on the family of the addresses, are computed.
+func CreatePacket(
+	srcPort,
+	destPort uint16,
+	src,
+	dest net.IP,
+	payload []byte,
+) (*Packet, []byte, error) {
+	length := HeaderSize + len(payload)
+	if length > 0xffff {
+		return nil, nil, errors.Errorf("UDP datagram of %d bytes too large", length)
+	}
+	p := &Packet{
+		Header: &Header{
+			SourcePort:      srcPort,
+			DestinationPort: destPort,
+			Length:          uint16(length),
+		},
+		Payload: payload,
+	}
+
+	packetSerialized, err := p.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing UDP packet")
+	}
+	checksum, err := protocols.Checksum(src, dest, ProtocolNumber, packetSerialized)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error calculating UDP checksum")
+	}
+	// a computed checksum of zero is sent as all ones, zero meaning that
+	// there is no checksum
+	if checksum == 0 {
+		checksum = 0xffff
+	}
+	p.Header.Checksum = checksum
+
+	packetSerialized, err = p.Serialize()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error serializing UDP packet")
+	}
+
+	return p, packetSerialized, nil
+}
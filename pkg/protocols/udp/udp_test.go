@@ -0,0 +1,113 @@
+package udp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/swagnikdutta/netprobe/pkg/protocols"
+)
+
+var (
+	src, dest     = net.IP{192, 0, 2, 1}, net.IP{192, 0, 2, 2}
+	srcV6, destV6 = net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+
+	// a datagram from port 1234 to port 53 carrying "hi", over IPv4
+	datagram = []byte{0x04, 0xd2, 0x00, 0x35, 0x00, 0x0a, 0x0e, 0x66, 'h', 'i'}
+	// the same datagram over IPv6
+	datagramV6 = []byte{0x04, 0xd2, 0x00, 0x35, 0x00, 0x0a, 0x36, 0xf5, 'h', 'i'}
+)
+
+func TestCreatePacket(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     net.IP
+		dest    net.IP
+		payload []byte
+		want    []byte
+	}{
+		{"IPv4", src, dest, []byte("hi"), datagram},
+		{"16 byte IPv4 addresses", net.IPv4(192, 0, 2, 1), net.IPv4(192, 0, 2, 2), []byte("hi"), datagram},
+		{"IPv6", srcV6, destV6, []byte("hi"), datagramV6},
+		// the checksum computed is zero, which is sent as all ones
+		{"zero checksum", src, dest, []byte{0x76, 0xcf}, []byte{0x04, 0xd2, 0x00, 0x35, 0x00, 0x0a, 0xff, 0xff, 0x76, 0xcf}},
+		{"empty", src, dest, nil, []byte{0x04, 0xd2, 0x00, 0x35, 0x00, 0x08, 0x76, 0xd3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, b, err := CreatePacket(1234, 53, tt.src, tt.dest, tt.payload)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, b)
+			assert.Equal(t, uint16(len(tt.want)), p.Header.Length)
+
+			// the checksum verifies
+			checksum, err := protocols.Checksum(tt.src, tt.dest, ProtocolNumber, b)
+			require.NoError(t, err)
+			assert.Zero(t, checksum)
+		})
+	}
+}
+
+func TestCreatePacketTooLarge(t *testing.T) {
+	_, _, err := CreatePacket(1234, 53, src, dest, make([]byte, 0xffff-HeaderSize+1))
+	assert.Error(t, err)
+}
+
+func TestParse(t *testing.T) {
+	noChecksum := []byte{0x04, 0xd2, 0x00, 0x35, 0x00, 0x0a, 0x00, 0x00, 'h', 'i'}
+
+	tests := []struct {
+		name     string
+		datagram []byte
+		src      net.IP
+		dest     net.IP
+		want     *Packet
+		wantErr  error
+	}{
+		{
+			name:     "IPv4",
+			datagram: datagram, src: src, dest: dest,
+			want: &Packet{Header: &Header{SourcePort: 1234, DestinationPort: 53, Length: 10, Checksum: 0x0e66}, Payload: []byte("hi")},
+		},
+		{
+			name:     "IPv6",
+			datagram: datagramV6, src: srcV6, dest: destV6,
+			want: &Packet{Header: &Header{SourcePort: 1234, DestinationPort: 53, Length: 10, Checksum: 0x36f5}, Payload: []byte("hi")},
+		},
+		{
+			name:     "checksum not verified",
+			datagram: datagramV6,
+			want:     &Packet{Header: &Header{SourcePort: 1234, DestinationPort: 53, Length: 10, Checksum: 0x36f5}, Payload: []byte("hi")},
+		},
+		{
+			name:     "no checksum over IPv4",
+			datagram: noChecksum, src: src, dest: dest,
+			want: &Packet{Header: &Header{SourcePort: 1234, DestinationPort: 53, Length: 10}, Payload: []byte("hi")},
+		},
+		{
+			name:     "trailing bytes",
+			datagram: append(append([]byte(nil), datagram...), 0, 0), src: src, dest: dest,
+			want: &Packet{Header: &Header{SourcePort: 1234, DestinationPort: 53, Length: 10, Checksum: 0x0e66}, Payload: []byte("hi")},
+		},
+		{name: "no checksum over IPv6", datagram: noChecksum, src: srcV6, dest: destV6, wantErr: ErrInvalidChecksum},
+		{name: "wrong addresses", datagram: datagram, src: src, dest: net.IP{192, 0, 2, 3}, wantErr: ErrInvalidChecksum},
+		{name: "IPv4 checksum over IPv6", datagram: datagram, src: srcV6, dest: destV6, wantErr: ErrInvalidChecksum},
+		{name: "truncated header", datagram: datagram[:7], wantErr: ErrTruncated},
+		{name: "truncated data", datagram: datagram[:9], wantErr: ErrTruncated},
+		{name: "length too small", datagram: []byte{0x04, 0xd2, 0x00, 0x35, 0x00, 0x07, 0x00, 0x00}, wantErr: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.datagram, tt.src, tt.dest)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, p)
+		})
+	}
+}
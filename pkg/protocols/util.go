@@ -4,13 +4,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"net"
+
+	"github.com/pkg/errors"
 )
 
 func CalculateChecksum(data []byte) uint16 {
-	if len(data)%2 == 1 {
-		data = append(data, 0x00)
-	}
-
 	sum := uint32(0)
 	// creating 16 bit words
 	for i := 0; i < len(data)-1; i += 2 {
@@ -18,6 +16,11 @@ func CalculateChecksum(data []byte) uint16 {
 		sum += word
 	}
 
+	// an odd trailing byte is treated as if it were padded with a zero byte
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+
 	// adding carry bits with lower 16 bits
 	for (sum >> 16) > 0 {
 		sum = (sum & 0xffff) + (sum >> 16)
@@ -28,13 +31,43 @@ func CalculateChecksum(data []byte) uint16 {
 	return uint16(checksum)
 }
 
+// Checksum calculates the checksum of b, a serialized upper-layer packet such
+// as UDP or TCP sent from src to dest, over a pseudo-header of the IP layer.
+// The IPv4 pseudo-header (RFC 9293, section 3.1) is used when both addresses
+// are IPv4 ones, the IPv6 pseudo-header (RFC 8200, section 8.1) otherwise.
+// Verifying the checksum of a received packet yields zero.
+func Checksum(src, dest net.IP, proto uint8, b []byte) (uint16, error) {
+	buf := new(bytes.Buffer)
+	if src4, dest4 := src.To4(), dest.To4(); src4 != nil && dest4 != nil {
+		if err := WriteBinary(buf, src4, dest4, uint8(0), proto, uint16(len(b))); err != nil {
+			return 0, err
+		}
+	} else {
+		if src.To16() == nil || dest.To16() == nil {
+			return 0, errors.Errorf("invalid address pair %v, %v", src, dest)
+		}
+		zero := [3]byte{}
+		if err := WriteBinary(buf, src.To16(), dest.To16(), uint32(len(b)), zero, proto); err != nil {
+			return 0, err
+		}
+	}
+	buf.Write(b)
+
+	return CalculateChecksum(buf.Bytes()), nil
+}
+
 func WriteBinary(buf *bytes.Buffer, values ...interface{}) error {
 	for _, value := range values {
 		if ip, ok := value.(net.IP); ok {
+			// IPv4 addresses are written as 4 octets, anything else as 16
 			octets := ip.To4()
-			if err := WriteBinary(buf, octets[0], octets[1], octets[2], octets[3]); err != nil {
-				return err
+			if octets == nil {
+				octets = ip.To16()
+			}
+			if octets == nil {
+				return errors.Errorf("invalid IP address %v", ip)
 			}
+			buf.Write(octets)
 			continue
 		}
 
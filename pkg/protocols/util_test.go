@@ -0,0 +1,80 @@
+package protocols
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateChecksum(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want uint16
+	}{
+		// the example of RFC 1071, section 3
+		{"RFC 1071", []byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}, 0x220d},
+		{"odd length", []byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6}, 0x2304},
+		{"empty", nil, 0xffff},
+		{"carry", []byte{0xff, 0xff, 0x00, 0x01}, 0xfffe},
+		{"IPv4 header", []byte{0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11, 0x00, 0x00, 0xc0, 0xa8, 0x00, 0x01, 0xc0, 0xa8, 0x00, 0xc7}, 0xb861},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CalculateChecksum(tt.data))
+		})
+	}
+}
+
+func TestCalculateChecksumVerifies(t *testing.T) {
+	// data carrying its own checksum sums to zero
+	data := []byte{0x08, 0x00, 0x00, 0x00, 0x12, 0x34, 0x00, 0x01}
+	checksum := CalculateChecksum(data)
+	data[2], data[3] = byte(checksum>>8), byte(checksum)
+	assert.Zero(t, CalculateChecksum(data))
+}
+
+func TestWriteBinary(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := WriteBinary(buf, uint8(1), uint16(0x0203), net.IPv4(192, 0, 2, 1), net.ParseIP("2001:db8::1"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		1, 2, 3,
+		192, 0, 2, 1,
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+	}, buf.Bytes())
+
+	assert.Error(t, WriteBinary(new(bytes.Buffer), net.IP{1, 2, 3}))
+}
+
+func TestChecksum(t *testing.T) {
+	// a UDP datagram from port 1234 to port 53 carrying "hi", its checksum
+	// left zero
+	datagram := []byte{0x04, 0xd2, 0x00, 0x35, 0x00, 0x0a, 0x00, 0x00, 'h', 'i'}
+
+	tests := []struct {
+		name string
+		src  net.IP
+		dest net.IP
+		want uint16
+	}{
+		{"IPv4", net.IP{192, 0, 2, 1}, net.IP{192, 0, 2, 2}, 0x0e66},
+		{"16 byte IPv4 addresses", net.IPv4(192, 0, 2, 1), net.IPv4(192, 0, 2, 2), 0x0e66},
+		{"IPv6", net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 0x36f5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checksum, err := Checksum(tt.src, tt.dest, 17, datagram)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, checksum)
+		})
+	}
+
+	_, err := Checksum(nil, net.IP{192, 0, 2, 2}, 17, datagram)
+	assert.Error(t, err)
+}
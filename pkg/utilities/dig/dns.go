@@ -3,16 +3,53 @@ package dig
 import (
 	"bytes"
 	"encoding/binary"
-	"net"
+	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/swagnikdutta/netprobe/pkg/protocols"
 )
 
 var (
-	typeA     uint16 = 1
-	classINET uint16 = 1
+	TypeA     RRType  = 1
+	TypeNS    RRType  = 2
+	TypeCNAME RRType  = 5
+	TypeSOA   RRType  = 6
+	TypePTR   RRType  = 12
+	TypeHINFO RRType  = 13
+	TypeMX    RRType  = 15
+	TypeTXT   RRType  = 16
+	TypeAAAA  RRType  = 28
+	TypeSRV   RRType  = 33
+	TypeNAPTR RRType  = 35
+	TypeSSHFP RRType  = 44
+	TypeTLSA  RRType  = 52
+	TypeANY   RRType  = 255
+	TypeCAA   RRType  = 257
+	ClassINET RRClass = 1
+
+	typeNames = map[RRType]string{
+		TypeA:     "A",
+		TypeNS:    "NS",
+		TypeCNAME: "CNAME",
+		TypeSOA:   "SOA",
+		TypePTR:   "PTR",
+		TypeHINFO: "HINFO",
+		TypeMX:    "MX",
+		TypeTXT:   "TXT",
+		TypeAAAA:  "AAAA",
+		TypeSRV:   "SRV",
+		TypeNAPTR: "NAPTR",
+		TypeSSHFP: "SSHFP",
+		TypeTLSA:  "TLSA",
+		TypeANY:   "ANY",
+		TypeCAA:   "CAA",
+	}
 
+	// flagInfo tells where each field of the second 16 bit word of the
+	// header lies: the position of its least significant bit, and the bits
+	// it covers (RFC 1035, section 4.1.1, and RFC 4035, section 3.2)
 	flagInfo = map[string]struct {
 		offset uint8
 		mask   uint16
@@ -23,14 +60,59 @@ var (
 		"TC":     {9, 0x0200},
 		"RD":     {8, 0x0100},
 		"RA":     {7, 0x0080},
-		"Z":      {6, 0x0070},
-		"RCODE":  {3, 0x000f},
+		"Z":      {6, 0x0040},
+		"AD":     {5, 0x0020},
+		"CD":     {4, 0x0010},
+		"RCODE":  {0, 0x000f},
 	}
 )
 
+var (
+	// ErrTruncated is returned when a message ends before its last field.
+	ErrTruncated = errors.New("truncated DNS message")
+	// ErrMalformed is returned when a domain name can't be decoded.
+	ErrMalformed = errors.New("malformed DNS message")
+
+	// headerSize is the size of the header, which every message starts with
+	headerSize = 12
+)
+
 type RRType uint16
 type RRClass uint16
 
+// String returns the mnemonic of t, eg: "MX", or its generic form, eg:
+// "TYPE65", for types that have none (RFC 3597).
+func (t RRType) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+// ParseType returns the type named name, either by its mnemonic, eg: "mx", or
+// in its generic form, eg: "TYPE65". It is case insensitive.
+func ParseType(name string) (RRType, error) {
+	name = strings.ToUpper(name)
+	for t, typeName := range typeNames {
+		if typeName == name {
+			return t, nil
+		}
+	}
+	if value, found := strings.CutPrefix(name, "TYPE"); found {
+		if n, err := strconv.ParseUint(value, 10, 16); err == nil {
+			return RRType(n), nil
+		}
+	}
+	return 0, errors.Errorf("unknown record type %q", name)
+}
+
+func (c RRClass) String() string {
+	if c == ClassINET {
+		return "IN"
+	}
+	return fmt.Sprintf("CLASS%d", c)
+}
+
 // Message is the format using which all communications in
 // domain protocol are carried out. It is divided into five
 // sections as shown below.
@@ -74,22 +156,35 @@ func (m *Message) Serialize() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func (m *Message) Deserialize(stream []byte) {
-	m.Header.Deserialize(stream)
+// Deserialize decodes a message received from a nameserver. Errors wrap
+// ErrTruncated or ErrMalformed.
+func (m *Message) Deserialize(stream []byte) error {
+	if err := m.Header.Deserialize(stream); err != nil {
+		return err
+	}
 
-	offset := uint16(12)
+	offset := headerSize
 	if m.Header.QDCOUNT != 0 {
-		m.Question.Deserialize(stream, &offset)
+		if err := m.Question.Deserialize(stream, &offset); err != nil {
+			return errors.Wrapf(err, "error decoding question")
+		}
 	}
 	if m.Header.ANCOUNT != 0 {
-		m.Answer.Deserialize(stream, &offset, m.Header.ANCOUNT)
+		if err := m.Answer.Deserialize(stream, &offset, m.Header.ANCOUNT); err != nil {
+			return errors.Wrapf(err, "error decoding answer section")
+		}
 	}
 	if m.Header.NSCOUNT != 0 {
-		m.Authority.Deserialize(stream, &offset, m.Header.NSCOUNT)
+		if err := m.Authority.Deserialize(stream, &offset, m.Header.NSCOUNT); err != nil {
+			return errors.Wrapf(err, "error decoding authority section")
+		}
 	}
 	if m.Header.ARCOUNT != 0 {
-		m.Additional.Deserialize(stream, &offset, m.Header.ARCOUNT)
+		if err := m.Additional.Deserialize(stream, &offset, m.Header.ARCOUNT); err != nil {
+			return errors.Wrapf(err, "error decoding additional section")
+		}
 	}
+	return nil
 }
 
 func (m *Message) hasAnswer() (*ResourceRecord, bool) {
@@ -100,6 +195,26 @@ func (m *Message) hasAnswer() (*ResourceRecord, bool) {
 	return m.Answer.Records[0], true
 }
 
+// answers returns the records of the answer section of type qtype, along with
+// the CNAME records leading to them, or all of them for TypeANY. It returns
+// nil if there is no record of type qtype.
+func (m *Message) answers(qtype RRType) []*ResourceRecord {
+	var records []*ResourceRecord
+	found := false
+	for _, rr := range m.Answer.Records {
+		if qtype == TypeANY || rr.Type == qtype {
+			found = true
+			records = append(records, rr)
+		} else if rr.Type == TypeCNAME {
+			records = append(records, rr)
+		}
+	}
+	if !found {
+		return nil
+	}
+	return records
+}
+
 func (m *Message) hasGlueRecord() (*ResourceRecord, bool) {
 	if m.Header.ARCOUNT == 0 {
 		return nil, false
@@ -107,7 +222,7 @@ func (m *Message) hasGlueRecord() (*ResourceRecord, bool) {
 
 	var glue *ResourceRecord
 	for i := 0; i < int(m.Header.ARCOUNT); i++ {
-		if m.Additional.Records[i].Type == 1 {
+		if m.Additional.Records[i].Type == TypeA {
 			glue = m.Additional.Records[i]
 			return glue, true
 		}
@@ -125,7 +240,7 @@ func (m *Message) hasNSRecord() (*ResourceRecord, bool) {
 	for i := 0; i < int(m.Header.NSCOUNT); i++ {
 		// sometimes authority section can have SOA (type 6) records. This has
 		// been the case for domains that doesn't exist eg: abcd.com
-		if m.Authority.Records[i].Type == 2 {
+		if m.Authority.Records[i].Type == TypeNS {
 			ns = m.Authority.Records[i]
 			return ns, true
 		}
@@ -173,9 +288,19 @@ type Header struct {
 	// is available in the name server.
 	RA uint8
 
-	// Z is a 3-bit field reserved for future use. Must be zero in all queries and responses.
+	// Z is a 1-bit field reserved for future use. Must be zero in all queries and responses.
 	Z uint8
 
+	// AD stands for Authentic Data. It's a 1-bit field set in responses by
+	// a validating resolver when every record of the answer and authority
+	// sections has been verified with DNSSEC, or in queries to ask whether
+	// they would be.
+	AD uint8
+
+	// CD stands for Checking Disabled. It's a 1-bit field which might be set
+	// in a query, to ask the resolver not to validate DNSSEC signatures.
+	CD uint8
+
 	// RCODE is response code. It's a 4 bit field set as a part of
 	// responses. The values are,
 	// 0	No error condition
@@ -208,6 +333,23 @@ type Header struct {
 	ARCOUNT uint16
 }
 
+// flagFields returns the fields of h packed into the second 16 bit word of the
+// header, by the names used in flagInfo.
+func (h *Header) flagFields() map[string]*uint8 {
+	return map[string]*uint8{
+		"QR":     &h.QR,
+		"Opcode": &h.Opcode,
+		"AA":     &h.AA,
+		"TC":     &h.TC,
+		"RD":     &h.RD,
+		"RA":     &h.RA,
+		"Z":      &h.Z,
+		"AD":     &h.AD,
+		"CD":     &h.CD,
+		"RCODE":  &h.RCODE,
+	}
+}
+
 func (h *Header) Serialize() ([]byte, error) {
 	buf := new(bytes.Buffer)
 
@@ -216,25 +358,11 @@ func (h *Header) Serialize() ([]byte, error) {
 	}
 
 	headerFlags := uint16(0)
-	for flagName, info := range flagInfo {
-		switch flagName {
-		case "QR":
-			headerFlags |= uint16(h.QR) << info.offset
-		case "Opcode":
-			headerFlags |= uint16(h.QR) << info.offset
-		case "AA":
-			headerFlags |= uint16(h.QR) << info.offset
-		case "TC":
-			headerFlags |= uint16(h.QR) << info.offset
-		case "RD":
-			headerFlags |= uint16(h.QR) << info.offset
-		case "RA":
-			headerFlags |= uint16(h.QR) << info.offset
-		case "Z":
-			headerFlags |= uint16(h.QR) << info.offset
-		case "RCODE":
-			headerFlags |= uint16(h.QR) << info.offset
-		}
+	for flagName, field := range h.flagFields() {
+		info := flagInfo[flagName]
+		// values too large for their field are truncated rather than
+		// spilling into the next one
+		headerFlags |= uint16(*field) << info.offset & info.mask
 	}
 
 	if err := protocols.WriteBinary(buf, headerFlags, h.QDCOUNT, h.ANCOUNT, h.NSCOUNT, h.ARCOUNT); err != nil {
@@ -244,36 +372,23 @@ func (h *Header) Serialize() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func (h *Header) Deserialize(stream []byte) {
+func (h *Header) Deserialize(stream []byte) error {
+	if len(stream) < headerSize {
+		return errors.Wrapf(ErrTruncated, "%d bytes, header needs %d", len(stream), headerSize)
+	}
 	h.ID = binary.BigEndian.Uint16(stream[:2])
 
 	flags := binary.BigEndian.Uint16(stream[2:4])
-	for flagName, info := range flagInfo {
-		value := (flags & info.mask) >> info.offset
-		switch flagName {
-		case "QR":
-			h.QR = uint8(value)
-		case "Opcode":
-			h.Opcode = uint8(value)
-		case "AA":
-			h.AA = uint8(value)
-		case "TC":
-			h.TC = uint8(value)
-		case "RD":
-			h.RD = uint8(value)
-		case "RA":
-			h.RA = uint8(value)
-		case "Z":
-			h.Z = uint8(value)
-		case "RCODE":
-			h.RCODE = uint8(value)
-		}
+	for flagName, field := range h.flagFields() {
+		info := flagInfo[flagName]
+		*field = uint8((flags & info.mask) >> info.offset)
 	}
 
 	h.QDCOUNT = binary.BigEndian.Uint16(stream[4:6])
 	h.ANCOUNT = binary.BigEndian.Uint16(stream[6:8])
 	h.NSCOUNT = binary.BigEndian.Uint16(stream[8:10])
 	h.ARCOUNT = binary.BigEndian.Uint16(stream[10:12])
+	return nil
 }
 
 // Question is the question for the name server. It contains
@@ -288,9 +403,18 @@ type Question struct {
 
 	// QType is a two octet code which specifies the type of the query
 	//
-	// type | value | meaning
-	// A    | 1     | a host address
-	// NS   | 2     | an authoritative name server
+	// type  | value | meaning
+	// A     | 1     | a host address
+	// NS    | 2     | an authoritative name server
+	// CNAME | 5     | the canonical name for an alias
+	// SOA   | 6     | marks the start of a zone of authority
+	// PTR   | 12    | a domain name pointer
+	// MX    | 15    | mail exchange
+	// TXT   | 16    | text strings
+	// AAAA  | 28    | an IPv6 host address
+	// SRV   | 33    | the location of a service
+	// ANY   | 255   | all records of the name
+	// CAA   | 257   | certification authorities allowed to issue
 	QType RRType
 
 	// QClass is a two octet code that specifies the class of the query.
@@ -302,7 +426,11 @@ type Question struct {
 
 func (q *Question) Serialize() ([]byte, error) {
 	buf := new(bytes.Buffer)
-	domains := strings.Split(q.QName, ".")
+	// the root name is made of the root label alone
+	var domains []string
+	if q.QName != "" {
+		domains = strings.Split(q.QName, ".")
+	}
 
 	for _, subdomain := range domains {
 		octetLength := len(subdomain)
@@ -320,60 +448,80 @@ func (q *Question) Serialize() ([]byte, error) {
 	buf.WriteByte(0)
 
 	// append queryType and queryClass
-	binary.Write(buf, binary.BigEndian, uint16(1))
-	binary.Write(buf, binary.BigEndian, uint16(1))
+	if err := protocols.WriteBinary(buf, q.QType, q.QClass); err != nil {
+		return nil, err
+	}
 	serialized := buf.Bytes()
 
 	return serialized, nil
 }
 
-func (q *Question) Deserialize(stream []byte, offset *uint16) {
-	q.QName = readVariableLengthField(stream, offset)
+func (q *Question) Deserialize(stream []byte, offset *int) error {
+	var err error
+	if q.QName, err = readVariableLengthField(stream, offset); err != nil {
+		return err
+	}
 
-	q.QType = RRType(binary.BigEndian.Uint16(stream[*offset : *offset+2]))
-	*offset += 2
+	qtype, err := readUint16(stream, offset)
+	if err != nil {
+		return err
+	}
+	q.QType = RRType(qtype)
 
-	q.QClass = RRClass(binary.BigEndian.Uint16(stream[*offset : *offset+2]))
-	*offset += 2
+	qclass, err := readUint16(stream, offset)
+	if err != nil {
+		return err
+	}
+	q.QClass = RRClass(qclass)
+	return nil
 }
 
 type Answer struct {
 	Records []*ResourceRecord
 }
 
-func (a *Answer) Deserialize(stream []byte, offset *uint16, ancount uint16) {
+func (a *Answer) Deserialize(stream []byte, offset *int, ancount uint16) error {
 	a.Records = make([]*ResourceRecord, ancount)
 
 	for i := 0; i < int(ancount); i++ {
 		a.Records[i] = new(ResourceRecord)
-		a.Records[i].Deserialize(stream, offset)
+		if err := a.Records[i].Deserialize(stream, offset); err != nil {
+			return errors.Wrapf(err, "error decoding record %d", i)
+		}
 	}
+	return nil
 }
 
 type Authority struct {
 	Records []*ResourceRecord
 }
 
-func (a *Authority) Deserialize(stream []byte, offset *uint16, nscount uint16) {
+func (a *Authority) Deserialize(stream []byte, offset *int, nscount uint16) error {
 	a.Records = make([]*ResourceRecord, nscount)
 
 	for i := 0; i < int(nscount); i++ {
 		a.Records[i] = new(ResourceRecord)
-		a.Records[i].Deserialize(stream, offset)
+		if err := a.Records[i].Deserialize(stream, offset); err != nil {
+			return errors.Wrapf(err, "error decoding record %d", i)
+		}
 	}
+	return nil
 }
 
 type Additional struct {
 	Records []*ResourceRecord
 }
 
-func (a *Additional) Deserialize(stream []byte, offset *uint16, arcount uint16) {
+func (a *Additional) Deserialize(stream []byte, offset *int, arcount uint16) error {
 	a.Records = make([]*ResourceRecord, arcount)
 
 	for i := 0; i < int(arcount); i++ {
 		a.Records[i] = new(ResourceRecord)
-		a.Records[i].Deserialize(stream, offset)
+		if err := a.Records[i].Deserialize(stream, offset); err != nil {
+			return errors.Wrapf(err, "error decoding record %d", i)
+		}
 	}
+	return nil
 }
 
 type ResourceRecord struct {
@@ -387,10 +535,11 @@ type ResourceRecord struct {
 	// two octets containing one of the RR CLASS codes.
 	Class RRClass
 
-	// TTL is a 32-bit signed integer that specifies the time
-	// interval that the resource record may be cached before
-	// the source of the information should again be consulted.
-	TTL uint16
+	// TTL is a 32-bit integer that specifies the time interval, in
+	// seconds, that the resource record may be cached before the source
+	// of the information should again be consulted. RFC 2181 restricts
+	// it to positive values.
+	TTL uint32
 
 	// an unsigned 16-bit integer that specifies the length in octets
 	// of the RDATA field.
@@ -401,31 +550,50 @@ type ResourceRecord struct {
 	// to the TYPE and CLASS of the resource record. For example,
 	// if the TYPE is A and the CLASS is IN, the RDATA field
 	// is a 4 octet ARPA Internet address.
+	//
+	// RDATA holds it in its zone file form, as returned by Data.String.
 	RDATA string
+
+	// Data is the decoded RDATA, eg: *MXData for MX records. It is an
+	// *UnknownData for types that aren't decoded.
+	Data RData
 }
 
-func (rr *ResourceRecord) Deserialize(stream []byte, offset *uint16) {
-	rr.Name = readVariableLengthField(stream, offset)
-	rr.Type = RRType(binary.BigEndian.Uint16(stream[*offset : *offset+2]))
-	*offset += 2
+func (rr *ResourceRecord) Deserialize(stream []byte, offset *int) error {
+	var err error
+	if rr.Name, err = readVariableLengthField(stream, offset); err != nil {
+		return err
+	}
 
-	rr.Class = RRClass(binary.BigEndian.Uint16(stream[*offset : *offset+2]))
-	*offset += 2
+	rrType, err := readUint16(stream, offset)
+	if err != nil {
+		return err
+	}
+	rr.Type = RRType(rrType)
 
-	rr.TTL = binary.BigEndian.Uint16(stream[*offset : *offset+4])
-	*offset += 4
+	class, err := readUint16(stream, offset)
+	if err != nil {
+		return err
+	}
+	rr.Class = RRClass(class)
 
-	rr.RDLENGTH = binary.BigEndian.Uint16(stream[*offset : *offset+2])
-	*offset += 2
+	if rr.TTL, err = readUint32(stream, offset); err != nil {
+		return err
+	}
+	if rr.RDLENGTH, err = readUint16(stream, offset); err != nil {
+		return err
+	}
 
-	if rr.Type == 1 || rr.Type == 28 {
-		// 1 for A, 28 for AAAA
-		rr.RDATA = net.IP(stream[*offset : *offset+rr.RDLENGTH]).String()
-		*offset += rr.RDLENGTH
-	} else if rr.Type == 2 || rr.Type == 5 {
-		// 2 for NS, 5 for CNAME
-		rr.RDATA = readVariableLengthField(stream, offset)
+	// RDATA is RDLENGTH bytes long whatever its type, and whether it could
+	// be decoded or not
+	end := *offset + int(rr.RDLENGTH)
+	if end > len(stream) {
+		return errors.Wrapf(ErrTruncated, "RDATA of %d bytes at offset %d, message is %d bytes", rr.RDLENGTH, *offset, len(stream))
 	}
+	rr.Data = parseRData(rr.Type, stream, *offset, end)
+	rr.RDATA = rr.Data.String()
+	*offset = end
+	return nil
 }
 
 func NewDNSMessage() *Message {
@@ -440,16 +608,21 @@ func NewDNSMessage() *Message {
 	return message
 }
 
-func NewDNSQuery(host string, txnID uint16) *Message {
+// NewDNSQuery returns a query for the records of type qtype of host. When
+// recurse is set, the nameserver is asked to resolve host recursively.
+func NewDNSQuery(host string, txnID uint16, qtype RRType, recurse bool) *Message {
 	query := NewDNSMessage()
 
 	query.Header.ID = txnID
-	query.Header.RD = 1
+	if recurse {
+		query.Header.RD = 1
+	}
 	query.Header.QDCOUNT = 1
 
-	query.Question.QName = host
-	query.Question.QType = RRType(typeA)
-	query.Question.QClass = RRClass(classINET)
+	// the root label is added by Question.Serialize
+	query.Question.QName = strings.TrimSuffix(host, ".")
+	query.Question.QType = qtype
+	query.Question.QClass = ClassINET
 
 	return query
 }
@@ -0,0 +1,89 @@
+package dig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuestionSerialize(t *testing.T) {
+	tests := []struct {
+		name  string
+		host  string
+		qtype RRType
+		want  []byte
+	}{
+		{"root", ".", TypeNS, []byte{0, 0, 2, 0, 1}},
+		{"empty", "", TypeNS, []byte{0, 0, 2, 0, 1}},
+		{"name", "example.com", TypeA, []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1}},
+		{"fully qualified name", "example.com.", TypeMX, []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 15, 0, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewDNSQuery(tt.host, 0, tt.qtype, false).Question.Serialize()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, b)
+
+			q := &Question{}
+			offset := 0
+			require.NoError(t, q.Deserialize(b, &offset))
+			assert.Equal(t, NewDNSQuery(tt.host, 0, tt.qtype, false).Question, q)
+			assert.Equal(t, len(b), offset)
+		})
+	}
+}
+
+func TestHeaderSerialize(t *testing.T) {
+	tests := []struct {
+		name   string
+		header Header
+		want   []byte
+	}{
+		{"query", Header{ID: 0xabcd, RD: 1, QDCOUNT: 1}, []byte{0xab, 0xcd, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}},
+		{"iterative query", Header{ID: 1, QDCOUNT: 1}, []byte{0, 1, 0x00, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}},
+		{"QR", Header{QR: 1}, []byte{0, 0, 0x80, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"opcode", Header{Opcode: 2}, []byte{0, 0, 0x10, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"largest opcode", Header{Opcode: 15}, []byte{0, 0, 0x78, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"AA", Header{AA: 1}, []byte{0, 0, 0x04, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"TC", Header{TC: 1}, []byte{0, 0, 0x02, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"RA", Header{RA: 1}, []byte{0, 0, 0x00, 0x80, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"Z", Header{Z: 1}, []byte{0, 0, 0x00, 0x40, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"AD", Header{AD: 1}, []byte{0, 0, 0x00, 0x20, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"CD", Header{CD: 1}, []byte{0, 0, 0x00, 0x10, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"RCODE", Header{RCODE: 5}, []byte{0, 0, 0x00, 0x05, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{
+			"response",
+			Header{ID: 0x1234, QR: 1, RD: 1, RA: 1, AD: 1, RCODE: 3, QDCOUNT: 1, ANCOUNT: 2, NSCOUNT: 3, ARCOUNT: 4},
+			[]byte{0x12, 0x34, 0x81, 0xa3, 0, 1, 0, 2, 0, 3, 0, 4},
+		},
+		{
+			"every flag",
+			Header{QR: 1, Opcode: 15, AA: 1, TC: 1, RD: 1, RA: 1, Z: 1, AD: 1, CD: 1, RCODE: 15},
+			[]byte{0, 0, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.header.Serialize()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, b)
+
+			h := &Header{}
+			require.NoError(t, h.Deserialize(b))
+			assert.Equal(t, tt.header, *h)
+		})
+	}
+}
+
+func TestHeaderDeserializeTruncated(t *testing.T) {
+	h := &Header{}
+	assert.ErrorIs(t, h.Deserialize([]byte{0, 0, 0x81, 0x80}), ErrTruncated)
+}
+
+func TestNewDNSQueryRecurse(t *testing.T) {
+	assert.Equal(t, uint8(1), NewDNSQuery("example.com", 1, TypeA, true).Header.RD)
+	assert.Equal(t, uint8(0), NewDNSQuery("example.com", 1, TypeA, false).Header.RD)
+}
@@ -0,0 +1,175 @@
+package dig
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	opcodeNames = map[uint8]string{
+		0: "QUERY",
+		1: "IQUERY",
+		2: "STATUS",
+		4: "NOTIFY",
+		5: "UPDATE",
+	}
+
+	rcodeNames = map[uint8]string{
+		0: "NOERROR",
+		1: "FORMERR",
+		2: "SERVFAIL",
+		3: "NXDOMAIN",
+		4: "NOTIMP",
+		5: "REFUSED",
+	}
+)
+
+// String returns rr as a line of a zone file, eg:
+// "example.com.	3600	IN	MX	10 mail.example.com."
+func (rr *ResourceRecord) String() string {
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s", fqdn(rr.Name), rr.TTL, rr.Class, rr.Type, rr.RDATA)
+}
+
+// displayOptions tells which parts of a response dig prints, as toggled by
+// its +[no]option arguments.
+type displayOptions struct {
+	cmd        bool
+	comments   bool
+	question   bool
+	answer     bool
+	authority  bool
+	additional bool
+	stats      bool
+	// short only prints the RDATA of the answer records
+	short bool
+}
+
+func newDisplayOptions() *displayOptions {
+	d := &displayOptions{}
+	d.setAll(true)
+	return d
+}
+
+func (d *displayOptions) setAll(on bool) {
+	d.cmd, d.comments, d.question, d.answer, d.authority, d.additional, d.stats = on, on, on, on, on, on, on
+}
+
+// set applies an option such as "+short", "+noall" or "+answer".
+func (d *displayOptions) set(arg string) error {
+	name := strings.TrimPrefix(arg, "+")
+	on := true
+	if strings.HasPrefix(name, "no") {
+		name, on = strings.TrimPrefix(name, "no"), false
+	}
+
+	toggles := map[string]*bool{
+		"cmd":        &d.cmd,
+		"comments":   &d.comments,
+		"question":   &d.question,
+		"answer":     &d.answer,
+		"authority":  &d.authority,
+		"additional": &d.additional,
+		"stats":      &d.stats,
+		"short":      &d.short,
+	}
+	if name == "all" {
+		d.setAll(on)
+		return nil
+	}
+	toggle, ok := toggles[name]
+	if !ok {
+		return errors.Errorf("unknown option %s", arg)
+	}
+	*toggle = on
+	return nil
+}
+
+// format renders resp the way dig does. args are the command line arguments,
+// echoed back by the cmd part.
+func (d *displayOptions) format(resp *Response, args []string) string {
+	m := resp.Message
+	var sb strings.Builder
+
+	if d.short {
+		for _, rr := range m.Answer.Records {
+			sb.WriteString(rr.RDATA + "\n")
+		}
+		return sb.String()
+	}
+
+	if d.cmd {
+		fmt.Fprintf(&sb, "\n; <<>> npctl dig <<>> %s\n", strings.Join(args, " "))
+	}
+	if d.comments {
+		h := m.Header
+		fmt.Fprintf(&sb, ";; Got answer:\n")
+		fmt.Fprintf(&sb, ";; ->>HEADER<<- opcode: %s, status: %s, id: %d\n", codeName(opcodeNames, h.Opcode), codeName(rcodeNames, h.RCODE), h.ID)
+		fmt.Fprintf(&sb, ";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n", h.flagsString(), h.QDCOUNT, h.ANCOUNT, h.NSCOUNT, h.ARCOUNT)
+	}
+
+	if d.question && m.Header.QDCOUNT != 0 {
+		d.sectionTitle(&sb, "QUESTION")
+		q := m.Question
+		fmt.Fprintf(&sb, ";%s\t\t\t%s\t%s\n", fqdn(q.QName), q.QClass, q.QType)
+	}
+	sections := []struct {
+		name    string
+		show    bool
+		records []*ResourceRecord
+	}{
+		{"ANSWER", d.answer, m.Answer.Records},
+		{"AUTHORITY", d.authority, m.Authority.Records},
+		{"ADDITIONAL", d.additional, m.Additional.Records},
+	}
+	for _, section := range sections {
+		if !section.show || len(section.records) == 0 {
+			continue
+		}
+		d.sectionTitle(&sb, section.name)
+		for _, rr := range section.records {
+			sb.WriteString(rr.String() + "\n")
+		}
+	}
+
+	if d.stats {
+		fmt.Fprintf(&sb, "\n;; Query time: %d msec\n", resp.Duration.Milliseconds())
+		fmt.Fprintf(&sb, ";; SERVER: %s#%d(%s) (UDP)\n", resp.Server, resp.Port, resp.Server)
+		fmt.Fprintf(&sb, ";; WHEN: %s\n", time.Now().Format("Mon Jan 02 15:04:05 MST 2006"))
+		fmt.Fprintf(&sb, ";; MSG SIZE  rcvd: %d\n\n", resp.Size)
+	}
+	return sb.String()
+}
+
+func (d *displayOptions) sectionTitle(sb *strings.Builder, name string) {
+	if d.comments {
+		fmt.Fprintf(sb, "\n;; %s SECTION:\n", name)
+	}
+}
+
+// flagsString returns the names of the flags set in h, eg: "qr rd ra".
+func (h *Header) flagsString() string {
+	flags := []struct {
+		name  string
+		value uint8
+	}{
+		{"qr", h.QR}, {"aa", h.AA}, {"tc", h.TC}, {"rd", h.RD}, {"ra", h.RA}, {"ad", h.AD}, {"cd", h.CD},
+	}
+	var set []string
+	for _, f := range flags {
+		if f.value != 0 {
+			set = append(set, f.name)
+		}
+	}
+	return strings.Join(set, " ")
+}
+
+// codeName returns the name of code, or code itself if it has none.
+func codeName(names map[uint8]string, code uint8) string {
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", code)
+}
@@ -0,0 +1,425 @@
+package dig
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RData is the decoded RDATA of a resource record. String returns it the way
+// it is written in zone files (RFC 1035, section 5.1), domain names being
+// fully qualified.
+type RData interface {
+	String() string
+}
+
+type AData struct {
+	Address net.IP
+}
+
+func (d *AData) String() string {
+	return d.Address.String()
+}
+
+type AAAAData struct {
+	Address net.IP
+}
+
+func (d *AAAAData) String() string {
+	return d.Address.String()
+}
+
+type NSData struct {
+	Host string
+}
+
+func (d *NSData) String() string {
+	return fqdn(d.Host)
+}
+
+type CNAMEData struct {
+	Target string
+}
+
+func (d *CNAMEData) String() string {
+	return fqdn(d.Target)
+}
+
+type PTRData struct {
+	Target string
+}
+
+func (d *PTRData) String() string {
+	return fqdn(d.Target)
+}
+
+// MXData names a mail exchange of the domain, exchanges with a lower
+// preference being tried first.
+type MXData struct {
+	Preference uint16
+	Exchange   string
+}
+
+func (d *MXData) String() string {
+	return fmt.Sprintf("%d %s", d.Preference, fqdn(d.Exchange))
+}
+
+// SOAData marks the start of a zone of authority. Its timers are in seconds.
+type SOAData struct {
+	// MName is the primary nameserver of the zone
+	MName string
+	// RName is the mailbox of the person responsible for the zone, its first
+	// label being the local part
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	// Minimum is the TTL of negative answers (RFC 2308)
+	Minimum uint32
+}
+
+func (d *SOAData) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", fqdn(d.MName), fqdn(d.RName), d.Serial, d.Refresh, d.Retry, d.Expire, d.Minimum)
+}
+
+// TXTData holds one or more character strings.
+type TXTData struct {
+	Strings []string
+}
+
+func (d *TXTData) String() string {
+	quoted := make([]string, len(d.Strings))
+	for i, s := range d.Strings {
+		quoted[i] = quote(s)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// SRVData locates a service (RFC 2782). Targets with a lower priority are
+// tried first, those of the same priority are picked in proportion to their
+// weight.
+type SRVData struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+func (d *SRVData) String() string {
+	return fmt.Sprintf("%d %d %d %s", d.Priority, d.Weight, d.Port, fqdn(d.Target))
+}
+
+// CAAData restricts the certification authorities allowed to issue
+// certificates for the domain (RFC 8659).
+type CAAData struct {
+	// Flags holds the issuer critical flag, 128
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+func (d *CAAData) String() string {
+	return fmt.Sprintf("%d %s %s", d.Flags, d.Tag, quote(d.Value))
+}
+
+// NAPTRData is a rule of the Dynamic Delegation Discovery System (RFC 3403).
+type NAPTRData struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Services    string
+	Regexp      string
+	Replacement string
+}
+
+func (d *NAPTRData) String() string {
+	return fmt.Sprintf("%d %d %s %s %s %s", d.Order, d.Preference, quote(d.Flags), quote(d.Services), quote(d.Regexp), fqdn(d.Replacement))
+}
+
+// SSHFPData is the fingerprint of an SSH host key (RFC 4255).
+type SSHFPData struct {
+	Algorithm       uint8
+	FingerprintType uint8
+	Fingerprint     []byte
+}
+
+func (d *SSHFPData) String() string {
+	return fmt.Sprintf("%d %d %X", d.Algorithm, d.FingerprintType, d.Fingerprint)
+}
+
+// TLSAData associates a TLS certificate, or its public key, with the domain
+// (RFC 6698).
+type TLSAData struct {
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+	Certificate  []byte
+}
+
+func (d *TLSAData) String() string {
+	return fmt.Sprintf("%d %d %d %X", d.Usage, d.Selector, d.MatchingType, d.Certificate)
+}
+
+// HINFOData describes the host. It is what servers answer ANY queries with
+// when they don't list every record (RFC 8482).
+type HINFOData struct {
+	CPU string
+	OS  string
+}
+
+func (d *HINFOData) String() string {
+	return fmt.Sprintf("%s %s", quote(d.CPU), quote(d.OS))
+}
+
+// UnknownData holds the RDATA of a type that isn't decoded, or that failed to
+// decode. It is written in the generic form of RFC 3597.
+type UnknownData struct {
+	Data []byte
+}
+
+func (d *UnknownData) String() string {
+	if len(d.Data) == 0 {
+		return `\# 0`
+	}
+	return fmt.Sprintf(`\# %d %x`, len(d.Data), d.Data)
+}
+
+// fqdn returns the fully qualified form of name, the root being ".".
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+// quote returns s as a quoted character string. Quotes and backslashes are
+// escaped, as are non-printable bytes, in the \DDD form.
+func quote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&sb, "\\%03d", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// rdataReader decodes the fields of the RDATA found in stream between offset
+// and end. Domain names are read from the whole stream, as they may point to
+// names found earlier in the message.
+type rdataReader struct {
+	stream []byte
+	offset int
+	end    int
+}
+
+func (r *rdataReader) need(n int) error {
+	if r.offset+n > r.end {
+		return errors.Errorf("RDATA too short: %d bytes left, %d needed", r.end-r.offset, n)
+	}
+	return nil
+}
+
+func (r *rdataReader) uint8() (uint8, error) {
+	if err := r.need(1); err != nil {
+		return 0, err
+	}
+	v := r.stream[r.offset]
+	r.offset++
+	return v, nil
+}
+
+func (r *rdataReader) uint16() (uint16, error) {
+	if err := r.need(2); err != nil {
+		return 0, err
+	}
+	v := binary.BigEndian.Uint16(r.stream[r.offset:])
+	r.offset += 2
+	return v, nil
+}
+
+func (r *rdataReader) uint32() (uint32, error) {
+	if err := r.need(4); err != nil {
+		return 0, err
+	}
+	v := binary.BigEndian.Uint32(r.stream[r.offset:])
+	r.offset += 4
+	return v, nil
+}
+
+// bytes returns the n next bytes, or every byte left if n is negative.
+func (r *rdataReader) bytes(n int) ([]byte, error) {
+	if n < 0 {
+		n = r.end - r.offset
+	}
+	if err := r.need(n); err != nil {
+		return nil, err
+	}
+	b := append([]byte(nil), r.stream[r.offset:r.offset+n]...)
+	r.offset += n
+	return b, nil
+}
+
+// characterString reads a length prefixed character string.
+func (r *rdataReader) characterString() (string, error) {
+	length, err := r.uint8()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(int(length))
+	return string(b), err
+}
+
+func (r *rdataReader) name() (string, error) {
+	if err := r.need(1); err != nil {
+		return "", err
+	}
+	name, err := readVariableLengthField(r.stream, &r.offset)
+	if err != nil {
+		return "", err
+	}
+	if r.offset > r.end {
+		return "", errors.Errorf("domain name runs past the end of RDATA")
+	}
+	return name, nil
+}
+
+// parseRData decodes the RDATA of type rrType found in stream between offset
+// and end, which must not run past the end of stream. Types that aren't
+// decoded, and RDATA that doesn't match its type, are returned as UnknownData.
+func parseRData(rrType RRType, stream []byte, offset, end int) RData {
+	r := &rdataReader{stream: stream, offset: offset, end: end}
+	data, err := r.read(rrType)
+	if err != nil || r.offset != r.end {
+		return &UnknownData{Data: append([]byte(nil), stream[offset:end]...)}
+	}
+	return data
+}
+
+func (r *rdataReader) read(rrType RRType) (RData, error) {
+	var err error
+	switch rrType {
+	case TypeA:
+		d := &AData{}
+		d.Address, err = r.bytes(net.IPv4len)
+		return d, err
+	case TypeAAAA:
+		d := &AAAAData{}
+		d.Address, err = r.bytes(net.IPv6len)
+		return d, err
+	case TypeNS:
+		d := &NSData{}
+		d.Host, err = r.name()
+		return d, err
+	case TypeCNAME:
+		d := &CNAMEData{}
+		d.Target, err = r.name()
+		return d, err
+	case TypePTR:
+		d := &PTRData{}
+		d.Target, err = r.name()
+		return d, err
+	case TypeMX:
+		d := &MXData{}
+		if d.Preference, err = r.uint16(); err != nil {
+			return nil, err
+		}
+		d.Exchange, err = r.name()
+		return d, err
+	case TypeSOA:
+		d := &SOAData{}
+		if d.MName, err = r.name(); err != nil {
+			return nil, err
+		}
+		if d.RName, err = r.name(); err != nil {
+			return nil, err
+		}
+		for _, field := range []*uint32{&d.Serial, &d.Refresh, &d.Retry, &d.Expire, &d.Minimum} {
+			if *field, err = r.uint32(); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	case TypeTXT:
+		d := &TXTData{}
+		for r.offset < r.end {
+			s, err := r.characterString()
+			if err != nil {
+				return nil, err
+			}
+			d.Strings = append(d.Strings, s)
+		}
+		return d, nil
+	case TypeSRV:
+		d := &SRVData{}
+		for _, field := range []*uint16{&d.Priority, &d.Weight, &d.Port} {
+			if *field, err = r.uint16(); err != nil {
+				return nil, err
+			}
+		}
+		d.Target, err = r.name()
+		return d, err
+	case TypeCAA:
+		d := &CAAData{}
+		if d.Flags, err = r.uint8(); err != nil {
+			return nil, err
+		}
+		if d.Tag, err = r.characterString(); err != nil {
+			return nil, err
+		}
+		value, err := r.bytes(-1)
+		d.Value = string(value)
+		return d, err
+	case TypeNAPTR:
+		d := &NAPTRData{}
+		for _, field := range []*uint16{&d.Order, &d.Preference} {
+			if *field, err = r.uint16(); err != nil {
+				return nil, err
+			}
+		}
+		for _, field := range []*string{&d.Flags, &d.Services, &d.Regexp} {
+			if *field, err = r.characterString(); err != nil {
+				return nil, err
+			}
+		}
+		d.Replacement, err = r.name()
+		return d, err
+	case TypeSSHFP:
+		d := &SSHFPData{}
+		for _, field := range []*uint8{&d.Algorithm, &d.FingerprintType} {
+			if *field, err = r.uint8(); err != nil {
+				return nil, err
+			}
+		}
+		d.Fingerprint, err = r.bytes(-1)
+		return d, err
+	case TypeTLSA:
+		d := &TLSAData{}
+		for _, field := range []*uint8{&d.Usage, &d.Selector, &d.MatchingType} {
+			if *field, err = r.uint8(); err != nil {
+				return nil, err
+			}
+		}
+		d.Certificate, err = r.bytes(-1)
+		return d, err
+	case TypeHINFO:
+		d := &HINFOData{}
+		if d.CPU, err = r.characterString(); err != nil {
+			return nil, err
+		}
+		d.OS, err = r.characterString()
+		return d, err
+	}
+
+	return nil, errors.Errorf("RDATA of type %s isn't decoded", rrType)
+}
@@ -0,0 +1,172 @@
+package dig
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeName encodes a domain name as a sequence of labels.
+func encodeName(labels ...string) []byte {
+	var b []byte
+	for _, label := range labels {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// reply returns a reply to a query for example.com holding a single answer
+// record of type rrType, its RDLENGTH being rdlength.
+func reply(rrType RRType, rdlength uint16, rdata []byte) []byte {
+	b := []byte{0xab, 0xcd, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0}
+	b = append(b, encodeName("example", "com")...)
+	b = append(b, 0, 1, 0, 1)
+
+	// the owner name points to the question's
+	b = append(b, 0xc0, 0x0c)
+	b = binary.BigEndian.AppendUint16(b, uint16(rrType))
+	b = append(b, 0, 1)
+	b = binary.BigEndian.AppendUint32(b, 3600)
+	b = binary.BigEndian.AppendUint16(b, rdlength)
+	return append(b, rdata...)
+}
+
+func TestParseRData(t *testing.T) {
+	cat := func(parts ...[]byte) []byte {
+		var b []byte
+		for _, part := range parts {
+			b = append(b, part...)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name   string
+		rrType RRType
+		rdata  []byte
+		want   RData
+		str    string
+	}{
+		{"A", TypeA, []byte{93, 184, 216, 34}, &AData{}, "93.184.216.34"},
+		{"AAAA", TypeAAAA, []byte{0x26, 0x06, 0x28, 0, 0x02, 0x20, 0, 1, 0x02, 0x48, 0x18, 0x93, 0x25, 0xc8, 0x19, 0x46}, &AAAAData{}, "2606:2800:220:1:248:1893:25c8:1946"},
+		{"NS", TypeNS, encodeName("a", "iana-servers", "net"), &NSData{Host: "a.iana-servers.net"}, "a.iana-servers.net."},
+		{"CNAME", TypeCNAME, []byte{3, 'w', 'w', 'w', 0xc0, 0x0c}, &CNAMEData{Target: "www.example.com"}, "www.example.com."},
+		{"PTR", TypePTR, []byte{0xc0, 0x0c}, &PTRData{Target: "example.com"}, "example.com."},
+		{"MX", TypeMX, cat([]byte{0, 10}, encodeName("mail"), nil), &MXData{Preference: 10, Exchange: "mail"}, "10 mail."},
+		{
+			"SOA", TypeSOA,
+			cat(encodeName("ns"), encodeName("admin"), []byte{0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 4, 0, 0, 0, 5}),
+			&SOAData{MName: "ns", RName: "admin", Serial: 1, Refresh: 2, Retry: 3, Expire: 4, Minimum: 5},
+			"ns. admin. 1 2 3 4 5",
+		},
+		{"TXT", TypeTXT, []byte{2, 'h', 'i', 3, 'a', '"', 0x01}, &TXTData{Strings: []string{"hi", "a\"\x01"}}, `"hi" "a\"\001"`},
+		{"empty TXT string", TypeTXT, []byte{0}, &TXTData{Strings: []string{""}}, `""`},
+		{"SRV", TypeSRV, cat([]byte{0, 1, 0, 2, 0x13, 0xc4}, encodeName("sip")), &SRVData{Priority: 1, Weight: 2, Port: 5060, Target: "sip"}, "1 2 5060 sip."},
+		{"CAA", TypeCAA, []byte{128, 5, 'i', 's', 's', 'u', 'e', 'c', 'a'}, &CAAData{Flags: 128, Tag: "issue", Value: "ca"}, `128 issue "ca"`},
+		{
+			"NAPTR", TypeNAPTR,
+			cat([]byte{0, 100, 0, 10, 1, 'u', 7}, []byte("E2U+sip"), []byte{0}, encodeName()),
+			&NAPTRData{Order: 100, Preference: 10, Flags: "u", Services: "E2U+sip", Regexp: ""},
+			`100 10 "u" "E2U+sip" "" .`,
+		},
+		{"SSHFP", TypeSSHFP, []byte{4, 2, 0xde, 0xad}, &SSHFPData{Algorithm: 4, FingerprintType: 2, Fingerprint: []byte{0xde, 0xad}}, "4 2 DEAD"},
+		{"TLSA", TypeTLSA, []byte{3, 1, 1, 0xbe, 0xef}, &TLSAData{Usage: 3, Selector: 1, MatchingType: 1, Certificate: []byte{0xbe, 0xef}}, "3 1 1 BEEF"},
+		{"HINFO", TypeHINFO, []byte{3, 'R', 'F', 'C', 4, '8', '4', '8', '2'}, &HINFOData{CPU: "RFC", OS: "8482"}, `"RFC" "8482"`},
+		{"unknown type", RRType(65280), []byte{1, 2}, &UnknownData{Data: []byte{1, 2}}, `\# 2 0102`},
+		{"A of the wrong length", TypeA, []byte{1, 2, 3}, &UnknownData{Data: []byte{1, 2, 3}}, `\# 3 010203`},
+		{"trailing bytes", TypeMX, cat([]byte{0, 10}, encodeName("mail"), []byte{0xff}), &UnknownData{Data: cat([]byte{0, 10}, encodeName("mail"), []byte{0xff})}, `\# 9 000a046d61696c00ff`},
+		{"name past RDATA", TypeNS, []byte{4, 'm', 'a'}, &UnknownData{Data: []byte{4, 'm', 'a'}}, `\# 3 046d61`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewDNSMessage()
+			require.NoError(t, m.Deserialize(reply(tt.rrType, uint16(len(tt.rdata)), tt.rdata)))
+			require.Len(t, m.Answer.Records, 1)
+
+			rr := m.Answer.Records[0]
+			assert.Equal(t, "example.com", rr.Name)
+			assert.Equal(t, tt.rrType, rr.Type)
+			assert.Equal(t, uint32(3600), rr.TTL)
+			switch want := tt.want.(type) {
+			case *AData:
+				assert.Equal(t, tt.str, rr.Data.(*AData).Address.String())
+			case *AAAAData:
+				assert.Equal(t, tt.str, rr.Data.(*AAAAData).Address.String())
+			default:
+				assert.Equal(t, want, rr.Data)
+			}
+			assert.Equal(t, tt.str, rr.RDATA)
+		})
+	}
+}
+
+func TestDeserializeBounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream []byte
+	}{
+		{"RDLENGTH past the end", reply(TypeTXT, 0xffff, []byte{0})},
+		{"RDLENGTH one byte too long", reply(TypeA, 5, []byte{1, 2, 3, 4})},
+		{"truncated header", []byte{0xab, 0xcd, 0x81, 0x80, 0, 1}},
+		{"truncated record", reply(TypeA, 4, nil)[:40]},
+		{"missing record", reply(TypeA, 4, nil)[:29]},
+		{"label past the end", []byte{0, 0, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0, 7, 'e', 'x'}},
+		{"truncated pointer", []byte{0, 0, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0}},
+		{"pointer to itself", []byte{0, 0, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0, 0x0c, 0, 1, 0, 1}},
+		{"pointer forward", []byte{0, 0, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0, 0x0e, 0, 0, 1, 0, 1}},
+		{"reserved label type", []byte{0, 0, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 1, 0, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewDNSMessage()
+			assert.NotPanics(t, func() {
+				assert.Error(t, m.Deserialize(tt.stream))
+			})
+		})
+	}
+}
+
+func TestReadVariableLengthFieldLoop(t *testing.T) {
+	// a label followed by a pointer back to it
+	stream := reply(TypeA, 4, []byte{1, 2, 3, 4})
+	offset := len(stream)
+	stream = append(stream, 1, 'a', 0xc0, byte(offset))
+
+	_, err := readVariableLengthField(stream, &offset)
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestReadVariableLengthField(t *testing.T) {
+	stream := reply(TypeCNAME, 6, []byte{3, 'w', 'w', 'w', 0xc0, 0x0c})
+
+	offset := 12
+	name, err := readVariableLengthField(stream, &offset)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", name)
+	assert.Equal(t, 25, offset)
+
+	// a pointer moves offset past itself only
+	offset = 29
+	name, err = readVariableLengthField(stream, &offset)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", name)
+	assert.Equal(t, 31, offset)
+
+	offset = len(stream) - 6
+	name, err = readVariableLengthField(stream, &offset)
+	require.NoError(t, err)
+	assert.Equal(t, "www.example.com", name)
+	assert.Equal(t, len(stream), offset)
+
+	root := []byte{0}
+	offset = 0
+	name, err = readVariableLengthField(root, &offset)
+	require.NoError(t, err)
+	assert.Equal(t, "", name)
+	assert.Equal(t, 1, offset)
+}
@@ -0,0 +1,141 @@
+package dig
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	resolvConfPath = "/etc/resolv.conf"
+	// defaultNdots is the number of dots a name needs to be tried as is
+	// before the search list, when resolv.conf doesn't tell
+	defaultNdots = 1
+
+	// replies with these rcodes tell about the nameserver rather than the
+	// name, the next nameserver is asked instead
+	rcodeServerFailure uint8 = 2
+	rcodeRefused       uint8 = 5
+)
+
+// ClientConfig is the configuration of a stub resolver, as read from
+// resolv.conf(5).
+type ClientConfig struct {
+	// Nameservers are tried in order, until one of them replies with
+	// something else than SERVFAIL or REFUSED.
+	Nameservers []string
+	// Search is the list of domains appended to names that aren't fully
+	// qualified.
+	Search []string
+	// Ndots is the number of dots a name needs to be tried as is before
+	// the domains of the search list are appended to it.
+	Ndots int
+}
+
+// ReadResolvConf reads the nameservers, search list and ndots option of the
+// resolv.conf file at path. As with the system resolver, the local host is
+// queried when no nameserver is listed, and a domain line stands for a
+// single domain search list.
+func ReadResolvConf(path string) (*ClientConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening %s", path)
+	}
+	defer f.Close()
+
+	config := &ClientConfig{Ndots: defaultNdots}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			if len(fields) > 1 {
+				config.Nameservers = append(config.Nameservers, fields[1])
+			}
+		case "domain":
+			if len(fields) > 1 {
+				config.Search = []string{fields[1]}
+			}
+		case "search":
+			// the last search or domain line wins
+			config.Search = append([]string(nil), fields[1:]...)
+		case "options":
+			for _, option := range fields[1:] {
+				if value, found := strings.CutPrefix(option, "ndots:"); found {
+					if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+						config.Ndots = n
+					}
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+
+	if len(config.Nameservers) == 0 {
+		config.Nameservers = []string{"127.0.0.1"}
+	}
+	return config, nil
+}
+
+// candidates returns the names to try in turn when looking up name: name as
+// is, then with each domain of the search list appended, or the other way
+// around if name has fewer dots than Ndots. Fully qualified names, ending
+// with a dot, are only tried as is.
+func (c *ClientConfig) candidates(name string) []string {
+	if strings.HasSuffix(name, ".") {
+		return []string{name}
+	}
+
+	var searched []string
+	for _, domain := range c.Search {
+		searched = append(searched, name+"."+strings.TrimSuffix(domain, "."))
+	}
+	if strings.Count(name, ".") >= c.Ndots {
+		return append([]string{name}, searched...)
+	}
+	return append(searched, name)
+}
+
+// LookupStub looks up the records of type qtype of host the way a stub
+// resolver does: recursive queries are sent to the nameservers of config,
+// for each candidate name of its search list in turn, until a nameserver
+// answers with records. Otherwise, the last reply received is returned.
+// Nameservers are queried on the port of r.
+func (r *Resolver) LookupStub(host string, qtype RRType, config *ClientConfig) (*Response, error) {
+	var last *Response
+	var lastErr error
+	for _, name := range config.candidates(host) {
+		for _, nameserver := range config.Nameservers {
+			resp, err := r.LookupAt(name, nameserver, qtype)
+			if err != nil {
+				r.Logger.logV("%v\n\n", err)
+				lastErr = err
+				continue
+			}
+			if _, has := resp.Message.hasAnswer(); has {
+				return resp, nil
+			}
+			last = resp
+			if rcode := resp.Message.Header.RCODE; rcode == rcodeServerFailure || rcode == rcodeRefused {
+				r.Logger.logV("nameserver %s replied %s\n\n", nameserver, codeName(rcodeNames, rcode))
+				continue
+			}
+			// the nameserver has replied, the next one wouldn't know
+			// better
+			break
+		}
+	}
+	if last == nil {
+		return nil, errors.Wrapf(lastErr, "no nameserver could be reached")
+	}
+	return last, nil
+}
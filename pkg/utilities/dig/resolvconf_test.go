@@ -0,0 +1,60 @@
+package dig
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadResolvConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\nnameserver 192.0.2.1\nnameserver 192.0.2.2\nsearch a.example b.example\noptions ndots:2 edns0\n"), 0o644))
+
+	config, err := ReadResolvConf(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.1", "192.0.2.2"}, config.Nameservers)
+	assert.Equal(t, []string{"a.example", "b.example"}, config.Search)
+	assert.Equal(t, 2, config.Ndots)
+
+	assert.Equal(t, []string{"host.a.example", "host.b.example", "host"}, config.candidates("host"))
+	assert.Equal(t, []string{"www.host.example", "www.host.example.a.example", "www.host.example.b.example"}, config.candidates("www.host.example"))
+	assert.Equal(t, []string{"host."}, config.candidates("host."))
+}
+
+func TestLookupStubNextNameserver(t *testing.T) {
+	for _, rcode := range []uint8{rcodeServerFailure, rcodeRefused} {
+		t.Run(rcodeNames[rcode], func(t *testing.T) {
+			failing, failed := serve(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, rcode)
+			answering, answered := serve(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: failing.Port}, 0)
+
+			r := NewResolver(false)
+			r.Port = failing.Port
+			config := &ClientConfig{Nameservers: []string{failing.IP.String(), answering.IP.String()}, Ndots: 1}
+			resp, err := r.LookupStub("example.com", TypeA, config)
+			require.NoError(t, err)
+			assert.Equal(t, answering.IP.String(), resp.Server)
+			assert.Equal(t, uint8(0), resp.Message.Header.RCODE)
+			assert.Len(t, failed, 1)
+			assert.Len(t, answered, 1)
+		})
+	}
+}
+
+func TestLookupStubNameError(t *testing.T) {
+	var nxdomain uint8 = 3
+	first, queried := serve(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, nxdomain)
+	second, notQueried := serve(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: first.Port}, 0)
+
+	r := NewResolver(false)
+	r.Port = first.Port
+	config := &ClientConfig{Nameservers: []string{first.IP.String(), second.IP.String()}, Ndots: 1}
+	resp, err := r.LookupStub("example.com", TypeA, config)
+	require.NoError(t, err)
+	assert.Equal(t, nxdomain, resp.Message.Header.RCODE)
+	assert.Len(t, queried, 1)
+	assert.Len(t, notQueried, 0)
+}
@@ -1,20 +1,36 @@
 package dig
 
 import (
-	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/swagnikdutta/netprobe/pkg/dialer"
 )
 
+var (
+	defaultPort    = 53
+	defaultTimeout = 5 * time.Second
+)
+
 // Resolver is a native implementation of a dns resolver
 type Resolver struct {
 	// RootNameserver stores the IP address of the root nameserver.
 	// There are 13 root nameservers in total, all of which are hardcoded in a resolver.
 	RootNameserver net.IP
 
+	// Port is the port nameservers are queried on.
+	Port int
+	// Timeout bounds the time waited for the reply to a query.
+	Timeout time.Duration
+	// Recurse sets the Recursion Desired flag of the queries sent by LookupAt
+	// and LookupStub, it is set by default. Lookup never sets it, as the
+	// nameservers it queries are authoritative.
+	Recurse bool
+
 	Dialer dialer.Dialer
 	Logger *Logger
 	Meta   struct {
@@ -25,16 +41,21 @@ type Resolver struct {
 func NewResolver(v bool) *Resolver {
 	r := new(Resolver)
 	r.RootNameserver = getNameserverIP()
+	r.Port = defaultPort
+	r.Timeout = defaultTimeout
+	r.Recurse = true
 	r.Logger = &Logger{Verbose: v}
 	r.Meta.TxnIDMap = make(map[uint16]interface{})
 	return r
 }
 
-func (r *Resolver) ResolveSource() (net.IP, error) {
-	// The address does not need to exist as unlike tcp, udp does not require a handshake.
-	// The goal here is to retrieve the outbound IP.
+// ResolveSource returns the local address used to reach dest.
+func (r *Resolver) ResolveSource(dest net.IP) (net.IP, error) {
+	// The address does not need to be listening as unlike tcp, udp does not require a handshake.
+	// The goal here is to retrieve the outbound IP picked by the routing table.
 	// Source: https://stackoverflow.com/a/37382208/3728336
-	conn, err := net.Dial("udp", "8.8.8.8:80")
+	address := net.JoinHostPort(dest.String(), "80")
+	conn, err := net.Dial("udp", address)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error resolving outbound ip address")
 	}
@@ -44,39 +65,68 @@ func (r *Resolver) ResolveSource() (net.IP, error) {
 	return sourceIP, nil
 }
 
-func (r *Resolver) ResolveDestination(host string) (net.IP, error) {
-	destIP, err := r.Resolve(host)
+// ResolveDestination returns the address of host. qtype selects between
+// IPv4 (TypeA) and IPv6 (TypeAAAA) addresses. If host already is an IP
+// address of the requested family, it is returned as is.
+func (r *Resolver) ResolveDestination(host string, qtype RRType) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if (ip.To4() != nil) != (qtype == TypeA) {
+			return nil, errors.Errorf("%s is not an address of the requested family", host)
+		}
+		return ip, nil
+	}
+
+	records, err := r.Resolve(host, qtype)
 	if err != nil {
 		return nil, err
 	}
 
-	return destIP, nil
+	return lastAddress(host, records)
+}
+
+// lastAddress returns the address of host held by the last of records, the
+// one that follows the CNAME records leading to it, if any. It returns an
+// error if that record isn't an A or AAAA record, eg: a CNAME record that
+// leads nowhere.
+func lastAddress(host string, records []*ResourceRecord) (net.IP, error) {
+	switch data := records[len(records)-1].Data.(type) {
+	case *AData:
+		return data.Address, nil
+	case *AAAAData:
+		return data.Address, nil
+	}
+	return nil, errors.Errorf("no address record for %s", host)
+}
+
+// Response is the reply of a nameserver to a query.
+type Response struct {
+	Message *Message
+	// Server is the address of the nameserver that sent the reply, and Port
+	// the port it was queried on
+	Server string
+	Port   int
+	// Duration is the time it took the reply to arrive
+	Duration time.Duration
+	// Size is the size of the reply, in octets
+	Size int
 }
 
-func (r *Resolver) Resolve(host string) (net.IP, error) {
+// Lookup iteratively queries nameservers for the records of type qtype of
+// host, starting from the root nameserver and following referrals, and
+// returns the first response that isn't a referral. That is either an answer,
+// or an authoritative answer telling that there is no such record.
+func (r *Resolver) Lookup(host string, qtype RRType) (*Response, error) {
 	nameserver := r.RootNameserver.String()
 
 	for {
-		reply, err := r.Query(host, nameserver)
+		resp, err := r.exchange(host, nameserver, qtype, false)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error querying host %s", host)
 		}
 
-		m := NewDNSMessage()
-		m.Deserialize(reply)
-
-		if answer, has := m.hasAnswer(); has {
-			if answer.Type == 1 {
-				r.Logger.logV("Answer record (type A) found\nnameserver:\t\t\t%s\naddress:\t\t\t%s\n\n", answer.Name, answer.RDATA)
-				return net.ParseIP(answer.RDATA), nil
-			}
-
-			// handles CNAME records
-			if answer.Type == 5 {
-				r.Logger.logV("Answer record (type CNAME) found\nnameserver:\t\t\t%s\naddress:\t\t\t%s\n\n", answer.Name, answer.RDATA)
-				nameserverDomain := answer.RDATA
-				return r.Resolve(nameserverDomain)
-			}
+		m := resp.Message
+		if _, has := m.hasAnswer(); has {
+			return resp, nil
 		}
 
 		if glueRecord, has := m.hasGlueRecord(); has {
@@ -89,68 +139,228 @@ func (r *Resolver) Resolve(host string) (net.IP, error) {
 			nameserverDomain := nsRecord.RDATA
 			r.Logger.logV("NS record found\nnameserver:\t\t\t%s\n\n", nsRecord.RDATA)
 
-			ip, err := r.Resolve(nameserverDomain)
+			// nameservers are always reached over IPv4
+			records, err := r.Resolve(nameserverDomain, TypeA)
 			if err != nil {
 				return nil, errors.Wrapf(err, "error resolving domain: %s", nameserverDomain)
 			}
 
-			nameserver = ip.String()
+			address, err := lastAddress(nameserverDomain, records)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error resolving domain: %s", nameserverDomain)
+			}
+			nameserver = address.String()
 			continue
 		}
 
-		return nil, errors.Errorf("Failed to resolve address of host: %s\n", host)
+		return resp, nil
+	}
+}
+
+// Resolve iteratively resolves host, starting from the root nameserver, and
+// returns the answer records of type qtype, or every answer record for
+// TypeANY. The CNAME records followed to reach them come first.
+func (r *Resolver) Resolve(host string, qtype RRType) ([]*ResourceRecord, error) {
+	resp, err := r.Lookup(host, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	m := resp.Message
+	if answer, has := m.hasAnswer(); has {
+		if records := m.answers(qtype); len(records) > 0 {
+			r.Logger.logV("Answer record (type %s) found\nnameserver:\t\t\t%s\naddress:\t\t\t%s\n\n", qtype, answer.Name, records[0].RDATA)
+			return records, nil
+		}
+
+		// handles CNAME records
+		if answer.Type == TypeCNAME {
+			r.Logger.logV("Answer record (type CNAME) found\nnameserver:\t\t\t%s\naddress:\t\t\t%s\n\n", answer.Name, answer.RDATA)
+			nameserverDomain := answer.RDATA
+			records, err := r.Resolve(nameserverDomain, qtype)
+			if err != nil {
+				return nil, err
+			}
+			return append([]*ResourceRecord{answer}, records...), nil
+		}
+	}
+
+	return nil, errors.Errorf("no %s record found for host: %s", qtype, host)
+}
+
+// LookupAt sends a single query for the records of type qtype of host to
+// server, asking it to resolve host recursively unless Recurse is unset, and
+// returns its reply as is.
+func (r *Resolver) LookupAt(host, server string, qtype RRType) (*Response, error) {
+	resp, err := r.exchange(host, server, qtype, r.Recurse)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying host %s", host)
+	}
+	return resp, nil
+}
+
+// exchange sends a query to nameserver and decodes its reply.
+func (r *Resolver) exchange(host, nameserver string, qtype RRType, recurse bool) (*Response, error) {
+	start := time.Now()
+	reply, err := r.Query(host, nameserver, qtype, recurse)
+	if err != nil {
+		return nil, err
+	}
+
+	m := NewDNSMessage()
+	if err := m.Deserialize(reply); err != nil {
+		return nil, errors.Wrapf(err, "error decoding reply from %s", nameserver)
 	}
+	return &Response{
+		Message:  m,
+		Server:   nameserver,
+		Port:     r.Port,
+		Duration: time.Since(start),
+		Size:     len(reply),
+	}, nil
 }
 
-func (r *Resolver) Query(host, nameserver string) ([]byte, error) {
+// Query sends a query for the records of type qtype of host to nameserver and
+// returns its reply. When recurse is set, nameserver is asked to resolve host
+// recursively.
+func (r *Resolver) Query(host, nameserver string, qtype RRType, recurse bool) ([]byte, error) {
 	r.Logger.logV("Querying nameserver %s for host: %s\n\n", nameserver, host)
 	txnID := r.generateTxnID()
-	message := NewDNSQuery(host, txnID)
+	message := NewDNSQuery(host, txnID, qtype, recurse)
 	stream, err := message.Serialize()
 	if err != nil {
 		return nil, errors.Wrapf(err, "error serializing resolver message")
 	}
 
-	address := fmt.Sprintf("%s:%s", nameserver, "53")
+	address := net.JoinHostPort(nameserver, strconv.Itoa(r.Port))
 	conn, err := r.Dialer.Dial("udp", address)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Error dialing DNS server %s", nameserver)
 	}
 	defer conn.Close()
 
+	if err := conn.SetDeadline(time.Now().Add(r.Timeout)); err != nil {
+		return nil, errors.Wrapf(err, "error setting deadline")
+	}
+
 	_, err = conn.Write(stream)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error sending message on connection")
 	}
 
 	reply := make([]byte, 2056)
-	_, err = conn.Read(reply)
+	n, err := conn.Read(reply)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error reading reply")
 	}
 
-	return reply, nil
+	return reply[:n], nil
 }
 
 func NewDigCommand() *cobra.Command {
 	digCmd := &cobra.Command{
-		Use:   "dig example.com",
-		Short: "resolve IP address of host",
-		Long:  "\nThe dig command uses the native resolver to resolve IP address of host",
-		Args:  cobra.RangeArgs(1, 2),
+		Use:   "dig [@server] example.com [type] [+option...]",
+		Short: "look up the DNS records of host",
+		Long: "\nThe dig command uses the native resolver to look up the records of host, of type A unless type is given, eg: MX, TXT or ANY." +
+			"\n\nRecords are resolved iteratively, starting from a root nameserver, unless a single recursive query is sent to @server, " +
+			"or to the nameservers of /etc/resolv.conf with --stub." +
+			"\n\nThe output is made of sections, which +[no]cmd, +[no]comments, +[no]question, +[no]answer, +[no]authority, +[no]additional and +[no]stats toggle, " +
+			"+noall turning them all off, eg: +noall +answer. +short only prints the records of the answer. " +
+			"+norecurse clears the Recursion Desired flag of the queries sent to @server or with --stub, iterative queries never setting it.",
+		Args: cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			host := args[0]
+			display := newDisplayOptions()
+			var server string
+			var positional []string
+			recurse := true
+			for _, arg := range args {
+				if strings.HasPrefix(arg, "@") {
+					server = strings.TrimPrefix(arg, "@")
+					continue
+				}
+				if arg == "+recurse" || arg == "+norecurse" {
+					recurse = arg == "+recurse"
+					continue
+				}
+				if strings.HasPrefix(arg, "+") {
+					if err := display.set(arg); err != nil {
+						cmd.PrintErrln(err)
+						return
+					}
+					continue
+				}
+				positional = append(positional, arg)
+			}
+			if len(positional) < 1 || len(positional) > 2 {
+				cmd.PrintErrln("expected a host, optionally followed by a record type")
+				return
+			}
+
+			host := positional[0]
+			qtype := TypeA
+			if len(positional) == 2 {
+				var err error
+				if qtype, err = ParseType(positional[1]); err != nil {
+					cmd.PrintErrln(err)
+					return
+				}
+			}
 
 			verbose, err := cmd.Flags().GetBool("verbose")
 			if err != nil {
 				cmd.PrintErrln(err)
 			}
 
+			port, err := cmd.Flags().GetInt("port")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			stub, err := cmd.Flags().GetBool("stub")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			// the root and TLD nameservers of iterative lookups are always
+			// queried on port 53
+			if cmd.Flags().Changed("port") && server == "" && !stub {
+				cmd.PrintErrln("-p/--port needs @server or --stub")
+				return
+			}
+
 			r := NewResolver(verbose)
-			ip, _ := r.Resolve(host)
-			r.Logger.log("IP address of %s is: %s\n", host, ip.String())
+			r.Recurse = recurse
+			r.Port = port
+			var resp *Response
+			switch {
+			case server != "":
+				// as with dig, a server given by name is resolved by the
+				// system, eg: localhost
+				var serverAddr *net.IPAddr
+				if serverAddr, err = net.ResolveIPAddr("ip", server); err != nil {
+					cmd.PrintErrln(errors.Wrapf(err, "error resolving server %s", server))
+					return
+				}
+				resp, err = r.LookupAt(host, serverAddr.IP.String(), qtype)
+			case stub:
+				var config *ClientConfig
+				if config, err = ReadResolvConf(resolvConfPath); err != nil {
+					cmd.PrintErrln(err)
+					return
+				}
+				resp, err = r.LookupStub(host, qtype, config)
+			default:
+				resp, err = r.Lookup(host, qtype)
+			}
+			if err != nil {
+				cmd.PrintErrln(err)
+				return
+			}
+			r.Logger.log("%s", display.format(resp, args))
 		},
 	}
+	digCmd.Flags().IntP("port", "p", defaultPort, "port to query @server, or the nameservers of /etc/resolv.conf with --stub, on")
+	digCmd.Flags().Bool("stub", false, "query the nameservers of /etc/resolv.conf, applying its search list and ndots, instead of resolving iteratively")
 	digCmd.Flags().BoolP("verbose", "v", false, "enable verbose mode to display detailed logs")
 
 	return digCmd
@@ -0,0 +1,137 @@
+package dig
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve answers every query received on addr with rcode, and an A record when
+// rcode is 0, until the test ends. The headers of the queries are sent on the
+// returned channel.
+func serve(t *testing.T, addr *net.UDPAddr, rcode uint8) (*net.UDPAddr, <-chan Header) {
+	if rcode != 0 {
+		return serveRecords(t, addr, rcode)
+	}
+	return serveRecords(t, addr, rcode, []byte{0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0x0e, 0x10, 0, 4, 192, 0, 2, 1})
+}
+
+// serveRecords answers every query received on addr with rcode and the answer
+// records given, in their wire format, until the test ends. The headers of
+// the queries are sent on the returned channel.
+func serveRecords(t *testing.T, addr *net.UDPAddr, rcode uint8, records ...[]byte) (*net.UDPAddr, <-chan Header) {
+	conn, err := net.ListenUDP("udp4", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	queries := make(chan Header, 16)
+	go func() {
+		b := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			query := append([]byte(nil), b[:n]...)
+			h := Header{}
+			if h.Deserialize(query) != nil {
+				continue
+			}
+			queries <- h
+
+			h.QR, h.AA, h.RA, h.RCODE = 1, 1, 1, rcode
+			h.ANCOUNT = uint16(len(records))
+			resp, _ := h.Serialize()
+			resp = append(resp, query[headerSize:]...)
+			for _, record := range records {
+				resp = append(resp, record...)
+			}
+			conn.WriteToUDP(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr), queries
+}
+
+func TestLookupClearsRecursionDesired(t *testing.T) {
+	addr, queries := serve(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 0)
+
+	r := NewResolver(false)
+	r.RootNameserver = addr.IP
+	r.Port = addr.Port
+	require.True(t, r.Recurse)
+
+	resp, err := r.Lookup("example.com", TypeA)
+	require.NoError(t, err)
+	require.Len(t, resp.Message.Answer.Records, 1)
+	assert.Equal(t, "192.0.2.1", resp.Message.Answer.Records[0].RDATA)
+	assert.Equal(t, uint8(0), (<-queries).RD)
+}
+
+func TestLookupAtRecurse(t *testing.T) {
+	addr, queries := serve(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 0)
+
+	for _, recurse := range []bool{true, false} {
+		r := NewResolver(false)
+		r.Port = addr.Port
+		r.Recurse = recurse
+
+		_, err := r.LookupAt("example.com", addr.IP.String(), TypeA)
+		require.NoError(t, err)
+		assert.Equal(t, recurse, (<-queries).RD == 1)
+	}
+}
+
+func TestQueryPort(t *testing.T) {
+	addr, queries := serve(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 0)
+
+	r := NewResolver(false)
+	r.Port = addr.Port
+	reply, err := r.Query("example.com", addr.IP.String(), TypeA, true)
+	require.NoError(t, err)
+	require.Greater(t, len(reply), headerSize)
+	assert.Equal(t, (<-queries).ID, binary.BigEndian.Uint16(reply))
+}
+
+func TestResolveDestinationNoAddress(t *testing.T) {
+	// the owner names are pointers to the name in the question
+	a := []byte{0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0x0e, 0x10, 0, 4, 192, 0, 2, 1}
+	danglingCNAME := append([]byte{0xc0, 0x0c, 0, 5, 0, 1, 0, 0, 0x0e, 0x10, 0, 6}, 3, 'w', 'w', 'w', 0xc0, 0x0c)
+	malformedA := []byte{0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0x0e, 0x10, 0, 3, 192, 0, 2}
+
+	tests := []struct {
+		name    string
+		records [][]byte
+	}{
+		{"CNAME chain ends without an address", [][]byte{a, danglingCNAME}},
+		{"malformed address", [][]byte{malformedA}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := serveRecords(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 0, tt.records...)
+
+			r := NewResolver(false)
+			r.RootNameserver = addr.IP
+			r.Port = addr.Port
+
+			ip, err := r.ResolveDestination("example.com", TypeA)
+			assert.ErrorContains(t, err, "no address record for example.com")
+			assert.Nil(t, ip)
+		})
+	}
+}
+
+func TestResolveDestination(t *testing.T) {
+	addr, _ := serve(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 0)
+
+	r := NewResolver(false)
+	r.RootNameserver = addr.IP
+	r.Port = addr.Port
+
+	ip, err := r.ResolveDestination("example.com", TypeA)
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", ip.String())
+}
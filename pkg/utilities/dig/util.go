@@ -1,50 +1,100 @@
 package dig
 
 import (
+	"encoding/binary"
 	"math/rand"
 	"net"
 	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 func isPointer(b uint8) bool {
 	return b>>6 == 3
 }
 
-func readVariableLengthField(stream []byte, offset *uint16) string {
+// maxNameLength is the largest size of a domain name, in its dotted form
+var maxNameLength = 255
+
+// readVariableLengthField reads the domain name found at offset in stream, a
+// whole message, and moves offset past it. The name may end with a pointer to
+// a name found earlier in the message (RFC 1035, section 4.1.4).
+func readVariableLengthField(stream []byte, offset *int) (string, error) {
 	var sb strings.Builder
-	var res string
+	pos := *offset
+	jumped := false
+	// every pointer has to point before the previous one, which rules out
+	// loops
+	limit := len(stream)
 
 	for {
-		currentByte := stream[*offset]
-
-		if isPointer(currentByte) {
-			nextByte := stream[*offset+1]
-			combined := uint16(currentByte)<<8 | uint16(nextByte)
-			ptrOffset := combined & 0x3fff
-			label := readVariableLengthField(stream, &ptrOffset)
-			sb.WriteString(label)
-			*offset += 2
-
-			entire := sb.String()
-			return entire
-		} else {
-			// null byte
-			if currentByte == 0 {
-				res = sb.String()
-				res = res[:len(res)-1]
-				*offset++
-				break
+		if pos >= len(stream) {
+			return "", errors.Wrapf(ErrTruncated, "domain name at offset %d", *offset)
+		}
+		currentByte := stream[pos]
+
+		switch {
+		case isPointer(currentByte):
+			if pos+1 >= len(stream) {
+				return "", errors.Wrapf(ErrTruncated, "domain name at offset %d", *offset)
+			}
+			ptrOffset := int(currentByte&0x3f)<<8 | int(stream[pos+1])
+			if ptrOffset >= pos || ptrOffset >= limit {
+				return "", errors.Wrapf(ErrMalformed, "compression pointer at offset %d doesn't point backwards", pos)
+			}
+			if !jumped {
+				*offset = pos + 2
+				jumped = true
+			}
+			limit, pos = ptrOffset, ptrOffset
+
+		// null byte
+		case currentByte == 0:
+			if !jumped {
+				*offset = pos + 1
+			}
+			// the root name has no label, and no trailing dot to trim
+			return strings.TrimSuffix(sb.String(), "."), nil
+
+		case currentByte>>6 != 0:
+			return "", errors.Wrapf(ErrMalformed, "unknown label type at offset %d", pos)
+
+		default:
+			start, end := pos+1, pos+int(currentByte)+1
+			if end > len(stream) {
+				return "", errors.Wrapf(ErrTruncated, "domain name at offset %d", *offset)
 			}
-			labelLength := currentByte
-			start, end := *offset+1, *offset+uint16(labelLength)+1
 			sb.Write(stream[start:end])
 			sb.WriteByte(0x2e)
-			*offset = end
+			if sb.Len() > maxNameLength {
+				return "", errors.Wrapf(ErrMalformed, "domain name at offset %d longer than %d bytes", *offset, maxNameLength)
+			}
+			pos = end
 		}
 	}
+}
 
-	return res
+// readUint16 reads the 16 bit integer found at offset in stream, and moves
+// offset past it.
+func readUint16(stream []byte, offset *int) (uint16, error) {
+	if *offset+2 > len(stream) {
+		return 0, errors.Wrapf(ErrTruncated, "16 bit field at offset %d", *offset)
+	}
+	v := binary.BigEndian.Uint16(stream[*offset:])
+	*offset += 2
+	return v, nil
+}
+
+// readUint32 reads the 32 bit integer found at offset in stream, and moves
+// offset past it.
+func readUint32(stream []byte, offset *int) (uint32, error) {
+	if *offset+4 > len(stream) {
+		return 0, errors.Wrapf(ErrTruncated, "32 bit field at offset %d", *offset)
+	}
+	v := binary.BigEndian.Uint32(stream[*offset:])
+	*offset += 4
+	return v, nil
 }
 
 func (r *Resolver) generateTxnID() uint16 {
@@ -0,0 +1,68 @@
+package ping
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// timestampSize is the size of the send timestamp carried at the start
+	// of the payload, in nanoseconds since the Unix epoch.
+	timestampSize = 8
+
+	// maxPatternSize is the maximum size of a payload fill pattern, as in iputils ping.
+	maxPatternSize = 16
+)
+
+// createPayload returns the payload, of size bytes, of an echo request sent at
+// sentAt. If there is room for it, the payload starts with sentAt so that the
+// round-trip time can be computed from the reply alone. The rest of the
+// payload is filled with pinger.pattern, or with the byte offset if there is
+// no pattern.
+func (pinger *Pinger) createPayload(size int, sentAt time.Time) []byte {
+	payload := make([]byte, size)
+
+	offset := 0
+	if size >= timestampSize {
+		binary.BigEndian.PutUint64(payload, uint64(sentAt.UnixNano()))
+		offset = timestampSize
+	}
+
+	for i := offset; i < len(payload); i++ {
+		if len(pinger.pattern) == 0 {
+			payload[i] = byte(i)
+			continue
+		}
+		payload[i] = pinger.pattern[(i-offset)%len(pinger.pattern)]
+	}
+
+	return payload
+}
+
+// parseTimestamp returns the send timestamp carried in the payload of an echo
+// reply, and false if the payload is too short to hold one.
+func (pinger *Pinger) parseTimestamp(payload []byte) (time.Time, bool) {
+	if pinger.size < timestampSize || len(payload) < timestampSize {
+		return time.Time{}, false
+	}
+	nanos := binary.BigEndian.Uint64(payload[:timestampSize])
+	return time.Unix(0, int64(nanos)), true
+}
+
+// parsePattern decodes a payload fill pattern given as hex digits, eg: "ff00".
+func parsePattern(pattern string) ([]byte, error) {
+	if len(pattern)%2 == 1 {
+		pattern = "0" + pattern
+	}
+	b, err := hex.DecodeString(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pattern must be specified as hex digits")
+	}
+	if len(b) > maxPatternSize {
+		return nil, errors.Errorf("pattern can't be longer than %d bytes", maxPatternSize)
+	}
+	return b, nil
+}
@@ -1,174 +1,709 @@
 package ping
 
 import (
-	"bytes"
-	"encoding/binary"
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/swagnikdutta/netprobe/pkg/dialer"
-	"github.com/swagnikdutta/netprobe/pkg/protocols/icmp"
-	"github.com/swagnikdutta/netprobe/pkg/protocols/ipv4"
 	"github.com/swagnikdutta/netprobe/pkg/utilities/dig"
 )
 
 var (
 	ICMPType           uint8 = 8
+	ICMPEchoReplyType  uint8 = 0
 	ICMPCode           uint8 = 0
 	ICMPProtocolNumber uint8 = 1
+	UDPProtocolNumber  uint8 = 17
 	Version            uint8 = 4
 	IHL                uint8 = 5
+	HopLimit           uint8 = 64
+
+	// defaultTimeout is used when Options.Timeout is not set.
+	defaultTimeout = 2 * time.Second
+	// defaultInterval is the time between probes used by npctl ping.
+	defaultInterval = time.Second
+	// defaultSize is the number of data bytes sent by npctl ping, which
+	// along with the ICMP header makes 64 bytes, as in iputils ping.
+	defaultSize = 56
+	// maxSize is the largest number of data bytes whose echo request, along
+	// with the IPv4 and ICMP headers, fits in the 16 bit total length.
+	maxSize = 65535 - 20 - 8
+	// maxSizeV6 is the largest number of data bytes whose echo request fits
+	// in the 16 bit payload length of IPv6, which leaves out the IPv6 header.
+	maxSizeV6 = 65535 - 8
 )
 
-type Pinger struct {
-	sourceIP net.IP
-	destIP   net.IP
-	count    uint8
-	resolver *dig.Resolver
-	dialer   dialer.NetworkDialer
+// Mode selects the kind of probes sent by a Pinger.
+type Mode uint8
+
+var (
+	// ModeICMP sends ICMP echo requests.
+	ModeICMP Mode = 0
+	// ModeTCP times the TCP handshake to Options.Port, for hosts that
+	// don't answer ICMP.
+	ModeTCP Mode = 1
+	// ModeUDP sends UDP datagrams to Options.Port, for hosts that answer
+	// neither ICMP nor TCP.
+	ModeUDP Mode = 2
+	// ModeTimestamp sends ICMP timestamp requests, whose replies tell how far
+	// the clock of the host is from ours. It is IPv4 only.
+	ModeTimestamp Mode = 3
+)
+
+// Options configures a Pinger.
+type Options struct {
+	// Mode selects the kind of probes to send, ICMP echo requests by default.
+	Mode Mode
+
+	// Port is the port probed in ModeTCP and ModeUDP.
+	Port int
+
+	// Count is the number of echo requests to send. Zero means keep
+	// sending until the run is cancelled or the deadline expires.
+	Count int
+
+	// Interval is the time between sending two consecutive echo requests.
+	Interval time.Duration
+
+	// Timeout is the time to wait for each reply. A probe that isn't
+	// answered within Timeout is counted as lost.
+	Timeout time.Duration
+
+	// Deadline bounds the duration of the whole run, regardless of how
+	// many probes have been sent. Zero means no deadline. Unlike iputils
+	// ping, which keeps sending until Count replies are received, a run
+	// with both a Count and a Deadline ends once Count probes have been
+	// sent, answered or not.
+	Deadline time.Duration
+
+	// IPVersion restricts pinging to IPv4 (4) or IPv6 (6) addresses.
+	// Zero picks whichever family host resolves to, preferring IPv4.
+	IPVersion uint8
+
+	// Size is the number of data bytes sent in each echo request. When it
+	// is at least 8, the data starts with the time the request was sent.
+	Size int
+
+	// Pattern is repeated to fill the data of echo requests. The data
+	// is filled with its byte offsets if no pattern is given.
+	Pattern []byte
+
+	// TTL is the time to live (IPv4) or hop limit (IPv6) of echo
+	// requests. Zero leaves it to the system default.
+	TTL uint8
+
+	// TOS is the type of service (IPv4) or traffic class (IPv6) of echo
+	// requests, which holds the DSCP and ECN bits.
+	TOS uint8
+
+	// RecordRoute adds the Record Route option to IPv4 echo requests, and
+	// prints the route recorded in the replies. It requires a raw socket.
+	RecordRoute bool
+
+	// IncludeHeader sends IPv4 echo requests along with the header built by
+	// npctl, with the IP_HDRINCL socket option, instead of letting the kernel
+	// build it from socket options. It requires a raw socket.
+	IncludeHeader bool
+
+	// Unprivileged sends echo requests over ICMP datagram sockets, which
+	// don't require root. It is enabled regardless of this setting if the
+	// process isn't allowed to open raw sockets.
+	Unprivileged bool
+
+	// Concurrency is the number of hosts pinged at once by Sweep.
+	Concurrency int
+
+	// Verbose enables detailed logs of address resolution.
+	Verbose bool
+}
+
+// validate checks that the settings of opts are within range. The size of
+// echo requests is checked against the limit of opts.IPVersion, or of IPv6
+// if the version is left to the address of the host, in which case it is
+// checked again once the host is resolved.
+func (opts *Options) validate() error {
+	switch {
+	case opts.Count < 0:
+		return errors.Errorf("count can't be negative: %d", opts.Count)
+	case opts.Interval < 0:
+		return errors.Errorf("interval can't be negative: %v", opts.Interval)
+	case opts.Timeout < 0:
+		return errors.Errorf("timeout can't be negative: %v", opts.Timeout)
+	case opts.Deadline < 0:
+		return errors.Errorf("deadline can't be negative: %v", opts.Deadline)
+	case opts.Concurrency < 0:
+		return errors.Errorf("concurrency can't be negative: %d", opts.Concurrency)
+	}
+	return checkSize(opts.Size, opts.IPVersion != 4)
 }
 
-func (pinger *Pinger) parseEchoReply(echoReply []byte, echoRequest *ipv4.Packet) {
-	if len(echoReply) == 0 {
-		fmt.Printf("Empty echo reply\n\n")
-		return
+// checkSize returns an error unless size data bytes fit in an echo request
+// sent over IPv4, or IPv6 if ipv6 is set.
+func checkSize(size int, ipv6 bool) error {
+	limit, version := maxSize, 4
+	if ipv6 {
+		limit, version = maxSizeV6, 6
+	}
+	if size < 0 || size > limit {
+		return errors.Errorf("size must be between 0 and %d bytes over IPv%d: %d", limit, version, size)
 	}
-	// echoReply represents a serialized IP packet where the initial 20 bytes constitute the IP header (hence icmpOffset: 20).
-	// Following the IP header are the bytes representing the IP payload, which, in this case, is the ICMP packet.
-	icmpOffset := 20
-	icmpHeaderSize := 8
-	icmpHeaderBytes := echoReply[icmpOffset : icmpOffset+icmpHeaderSize]
+	return nil
+}
 
-	seqNoOffset := 6
-	seqNo := binary.BigEndian.Uint16(icmpHeaderBytes[seqNoOffset:])
-	fmt.Printf("received ICMP echo packet from %v, seq no: %v\n\n", echoRequest.Header.DestinationIP, seqNo)
+type Pinger struct {
+	ipVersion uint8
+	mode      Mode
+	port      int
+	// privileged is set when raw sockets are used, in which case IPv4
+	// packets are sent and received with their header.
+	privileged bool
+	// dontFragment sets the Don't Fragment flag on IPv4 echo requests, whose
+	// header has to be included.
+	dontFragment bool
+	recordRoute  bool
+	// includeHeader is set when echo requests are written with their IPv4
+	// header.
+	includeHeader bool
+	id            uint16
+	size          int
+	pattern       []byte
+	ttl           uint8
+	tos           uint8
+	count         int
+	interval      time.Duration
+	timeout       time.Duration
+	deadline      time.Duration
+	concurrency   int
+	resolver      *dig.Resolver
+	dialer        dialer.NetworkDialer
 }
 
-func (pinger *Pinger) sendPacket(host string, packet []byte) ([]byte, error) {
-	conn, err := pinger.dialer.Dial("ip4:icmp", pinger.destIP.String())
+// resolve returns the target for host, whose destination address is in the
+// family selected by pinger.ipVersion, and whose source address is the local
+// address used to reach it.
+func (pinger *Pinger) resolve(host string) (*target, error) {
+	var ip net.IP
+	var err error
+	switch pinger.ipVersion {
+	case 4:
+		ip, err = pinger.resolver.ResolveDestination(host, dig.TypeA)
+	case 6:
+		ip, err = pinger.resolver.ResolveDestination(host, dig.TypeAAAA)
+	default:
+		ip, err = pinger.resolver.ResolveDestination(host, dig.TypeA)
+		if err != nil {
+			var errV6 error
+			if ip, errV6 = pinger.resolver.ResolveDestination(host, dig.TypeAAAA); errV6 == nil {
+				err = nil
+			}
+		}
+	}
 	if err != nil {
-		return nil, errors.Wrapf(err, "error eshtablishing connection with %s", host)
+		return nil, errors.Wrapf(err, "error resolving destination address")
 	}
-	defer conn.Close()
+	t := &target{host: host, destIP: ip}
 
-	_, err = conn.Write(packet)
+	ip, err = pinger.resolver.ResolveSource(t.destIP)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error sending ICMP echo request")
+		return nil, errors.Wrapf(err, "error resolving source address")
 	}
+	t.sourceIP = ip
 
-	reply := make([]byte, 2048)
+	if pinger.includeHeader {
+		if t.mtu, err = interfaceMTU(t.sourceIP); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
 
-	_, err = conn.Read(reply)
+// interfaceMTU returns the MTU of the interface the local address ip belongs to.
+func interfaceMTU(ip net.IP) (int, error) {
+	interfaces, err := net.Interfaces()
 	if err != nil {
-		return nil, errors.Wrapf(err, "error receiving ICMP echo response")
+		return 0, errors.Wrapf(err, "error listing network interfaces")
+	}
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return iface.MTU, nil
+			}
+		}
+	}
+	return 0, errors.Errorf("no interface has address %v", ip)
+}
+
+// replyDeadline returns the point in time until which a reply to a probe sent
+// at sentAt is awaited. It is bounded by the overall deadline of the run, if any.
+func (pinger *Pinger) replyDeadline(sentAt, runDeadline time.Time) time.Time {
+	deadline := sentAt.Add(pinger.timeout)
+	if !runDeadline.IsZero() && runDeadline.Before(deadline) {
+		return runDeadline
+	}
+	return deadline
+}
+
+// isTimeout reports whether err was caused by a probe not being answered in time.
+func isTimeout(err error) bool {
+	if errors.Is(err, errTimeout) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// newProber returns the prober for pinger.mode, for targets in the IPv6 family
+// if ipv6 is set, and a function releasing it. An ICMP socket is closed as
+// soon as ctx is done.
+func (pinger *Pinger) newProber(ctx context.Context, ipv6 bool) (prober, func(), error) {
+	switch pinger.mode {
+	case ModeTCP:
+		return &tcpProber{pinger: pinger, port: pinger.port}, func() {}, nil
+	case ModeUDP:
+		return pinger.newUDPProber(ctx, ipv6)
+	case ModeTimestamp:
+		// ICMP datagram sockets only let echo requests through
+		if !pinger.privileged {
+			return nil, nil, errors.New("ICMP timestamp requests require a raw socket, run as root")
+		}
+	}
+	if err := checkSize(pinger.size, ipv6); err != nil {
+		return nil, nil, err
+	}
+	// ICMP datagram sockets don't pass up the IP header of replies
+	if pinger.recordRoute && !pinger.privileged {
+		return nil, nil, errors.New("recording the route requires a raw socket, run as root")
+	}
+	if pinger.includeHeader && (!pinger.privileged || ipv6) {
+		return nil, nil, errors.New("sending IPv4 headers requires a raw IPv4 socket, run as root")
 	}
-	reply = bytes.Trim(reply, "\x00")
 
-	return reply, nil
+	s, err := pinger.newSession(ipv6)
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := closeOnCancel(ctx, s.conn)
+	return s, func() {
+		stop()
+		s.Close()
+	}, nil
 }
 
-func (pinger *Pinger) Ping(host string) error {
-	ip, err := pinger.resolver.ResolveSource()
+// Ping sends pinger.count probes to host, one every pinger.interval, and reports
+// the round-trip time of every reply. Probes are ICMP echo requests, TCP
+// handshakes in ModeTCP, UDP datagrams in ModeUDP or ICMP timestamp requests in
+// ModeTimestamp. A count of zero keeps pinging until ctx is cancelled
+// or the deadline expires. The returned Statistics summarise the whole run,
+// including runs that were cut short by ctx.
+func (pinger *Pinger) Ping(ctx context.Context, host string) (*Statistics, error) {
+	t, err := pinger.resolve(host)
 	if err != nil {
-		return errors.Wrapf(err, "error resolving source address")
+		return nil, err
 	}
-	pinger.sourceIP = ip
 
-	ip, err = pinger.resolver.ResolveDestination(host)
+	if pinger.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pinger.deadline)
+		defer cancel()
+	}
+
+	p, closeProber, err := pinger.newProber(ctx, t.isIPv6())
 	if err != nil {
-		return errors.Wrapf(err, "error resolving destination address")
+		return nil, err
 	}
-	pinger.destIP = ip
+	defer closeProber()
 
-	fmt.Printf("\nAddress resolution complete\nHost address: \t\t%v\nDestination address: \t%v\n\nPerforming ping tests...\n\n", pinger.sourceIP, pinger.destIP)
+	fmt.Printf("\nAddress resolution complete\nHost address: \t\t%v\nDestination address: \t%v\n\nPerforming ping tests...\n\n", t.sourceIP, t.destIP)
+
+	stats, err := pinger.run(ctx, p, t, true)
+	if err != nil {
+		return stats, err
+	}
+	fmt.Print(stats)
+	return stats, nil
+}
+
+// run sends pinger.count probes to t with p, one every pinger.interval, and
+// returns the statistics of the answers. Every probe and its outcome is
+// printed if verbose is set.
+func (pinger *Pinger) run(ctx context.Context, p prober, t *target, verbose bool) (*Statistics, error) {
+	runDeadline, _ := ctx.Deadline()
+	stats := &Statistics{Host: t.host, IP: t.destIP}
+	start := time.Now()
+
+	for i := 0; pinger.count == 0 || i < pinger.count; i++ {
+		// the wait for the last reply may end on the deadline just before
+		// ctx does, no probe is sent past it
+		if ctx.Err() != nil || (!runDeadline.IsZero() && !time.Now().Before(runDeadline)) {
+			break
+		}
 
-	for i := 0; i < int(pinger.count); i++ {
 		seqNo := uint16(i)
-		icmpPacket, icmpSerialized, err := icmp.CreatePacket(
-			ICMPType,
-			ICMPCode,
-			0,
-			0,
-			seqNo,
-			nil,
-		)
-		if err != nil {
-			return errors.Wrapf(err, "error creating ICMP packet")
+		sentAt := time.Now()
+		reply, err := p.probe(ctx, t, seqNo, sentAt, pinger.replyDeadline(sentAt, runDeadline), verbose)
+		if ctx.Err() != nil {
+			stats.PacketsSent++
+			break
 		}
 
-		ipPacket, ipSerialized, err := ipv4.CreatePacket(
-			Version,
-			IHL,
-			0,
-			0,
-			64,
-			ICMPProtocolNumber,
-			0,
-			0,
-			0,
-			0,
-			pinger.sourceIP,
-			pinger.destIP,
-			icmpSerialized,
-		)
-		if err != nil {
-			return errors.Wrapf(err, "error creating IPv4 packet")
+		var probeErr *probeError
+		var connErr *connectError
+		answered := err == nil || errors.As(err, &probeErr) || errors.As(err, &connErr)
+		if !answered && !isTimeout(err) {
+			return stats.finish(start), err
+		}
+		stats.PacketsSent++
+
+		switch {
+		case isTimeout(err):
+			if verbose {
+				fmt.Printf("request timeout for seq no: %v\n\n", seqNo)
+			}
+		case probeErr != nil:
+			stats.Errors++
+			if verbose {
+				fmt.Printf("%v, seq no: %v\n\n", probeErr, probeErr.SequenceNumber)
+			}
+		case connErr != nil:
+			stats.Errors++
+			if verbose {
+				fmt.Printf("%v, seq no: %v\n\n", connErr, connErr.SequenceNumber)
+			}
+		default:
+			rtt := reply.rtt(sentAt)
+			stats.addRTT(rtt)
+			if offset, ok := reply.clockOffset(); ok {
+				stats.ClockOffsets = append(stats.ClockOffsets, offset)
+			}
+			if verbose {
+				p.printReply(reply, rtt)
+			}
 		}
 
-		reply, err := pinger.sendPacket(host, ipSerialized)
-		fmt.Printf("sent ICMP echo request (%v bytes) from %v, to %v, identifier: %v, seq_no: %v\n",
-			ipPacket.Header.TotalLength,
-			ipPacket.Header.SourceIP,
-			ipPacket.Header.DestinationIP,
-			icmpPacket.Header.Identifier,
-			icmpPacket.Header.SequenceNumber,
-		)
-		pinger.parseEchoReply(reply, ipPacket)
+		if pinger.count != 0 && i+1 == pinger.count {
+			break
+		}
+		if !pinger.wait(ctx, sentAt) {
+			break
+		}
 	}
 
-	fmt.Println("Ping tests completed.")
-	return nil
+	return stats.finish(start), nil
+}
+
+// closeOnCancel closes conn as soon as ctx is cancelled, until stop is called.
+// A pending read is only interrupted by closing the connection, so that
+// cancelling ctx doesn't have to wait for the reply timeout.
+func closeOnCancel(ctx context.Context, conn net.Conn) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
 }
 
-func NewPinger(count int, verbose bool) *Pinger {
+// wait blocks until the next probe is due, i.e. pinger.interval after sentAt.
+// It returns false if ctx was cancelled in the meantime.
+func (pinger *Pinger) wait(ctx context.Context, sentAt time.Time) bool {
+	timer := time.NewTimer(time.Until(sentAt.Add(pinger.interval)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func NewPinger(opts Options) *Pinger {
 	pinger := &Pinger{
-		count:  uint8(count),
-		dialer: new(dialer.Dialer),
+		ipVersion:     opts.IPVersion,
+		mode:          opts.Mode,
+		port:          opts.Port,
+		count:         opts.Count,
+		interval:      opts.Interval,
+		timeout:       opts.Timeout,
+		deadline:      opts.Deadline,
+		concurrency:   opts.Concurrency,
+		size:          opts.Size,
+		pattern:       opts.Pattern,
+		ttl:           opts.TTL,
+		tos:           opts.TOS,
+		recordRoute:   opts.RecordRoute,
+		includeHeader: opts.IncludeHeader,
+		// the identifier tells apart the replies to concurrent ping processes
+		id: uint16(os.Getpid() & 0xffff),
+	}
+	if opts.Unprivileged || !dialer.HasRawSocketCapability() {
+		pinger.dialer = new(dialer.DatagramDialer)
+	} else {
+		pinger.privileged = true
+		pinger.dialer = new(dialer.Dialer)
+	}
+	if pinger.timeout <= 0 {
+		pinger.timeout = defaultTimeout
+	}
+	if pinger.port == 0 {
+		pinger.port = defaultPort
+	}
+	if pinger.concurrency <= 0 {
+		pinger.concurrency = defaultConcurrency
 	}
-	pinger.resolver = dig.NewResolver(verbose)
+	pinger.resolver = dig.NewResolver(opts.Verbose)
 	return pinger
 }
 
 func NewPingCommand() *cobra.Command {
 	pingCmd := &cobra.Command{
-		Use:   "ping example.com",
+		Use:   "ping example.com [host...]",
 		Short: "send ICMP ECHO_REQUEST packets to network host",
 		Long:  "\nThe ping utility is used to test connection with a host by sending ICMP echo request packets",
-		Args:  cobra.RangeArgs(1, 2),
+		Args:  cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			host := args[0]
+			hosts := args
 
 			count, err := cmd.Flags().GetInt("count")
 			if err != nil {
 				cmd.PrintErrln(err)
 			}
 
+			interval, err := cmd.Flags().GetFloat64("interval")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			timeout, err := cmd.Flags().GetFloat64("timeout")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			deadline, err := cmd.Flags().GetFloat64("deadline")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			ipv4Only, err := cmd.Flags().GetBool("ipv4")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			ipv6Only, err := cmd.Flags().GetBool("ipv6")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			var ipVersion uint8
+			if ipv4Only {
+				ipVersion = 4
+			} else if ipv6Only {
+				ipVersion = 6
+			}
+
+			size, err := cmd.Flags().GetInt("size")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			patternHex, err := cmd.Flags().GetString("pattern")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+			pattern, err := parsePattern(patternHex)
+			if err != nil {
+				cmd.PrintErrln(err)
+				return
+			}
+
+			ttl, err := cmd.Flags().GetUint8("ttl")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			tos, err := cmd.Flags().GetUint8("tos")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			unprivileged, err := cmd.Flags().GetBool("unprivileged")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
 			verbose, err := cmd.Flags().GetBool("verbose")
 			if err != nil {
 				cmd.PrintErrln(err)
 			}
 
-			pinger := NewPinger(count, verbose)
-			if err := pinger.Ping(host); err != nil {
+			sweep, err := cmd.Flags().GetString("sweep")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+			if sweep != "" {
+				addrs, err := expandCIDR(sweep)
+				if err != nil {
+					cmd.PrintErrln(err)
+					return
+				}
+				hosts = append(hosts, addrs...)
+			}
+
+			targetsFile, err := cmd.Flags().GetString("targets")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+			if targetsFile != "" {
+				targets, err := readTargets(targetsFile)
+				if err != nil {
+					cmd.PrintErrln(err)
+					return
+				}
+				hosts = append(hosts, targets...)
+			}
+
+			if len(hosts) == 0 {
+				cmd.PrintErrln("no host to ping")
+				return
+			}
+
+			concurrency, err := cmd.Flags().GetInt("concurrency")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			tcp, err := cmd.Flags().GetBool("tcp")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			udp, err := cmd.Flags().GetBool("udp")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			recordRoute, err := cmd.Flags().GetBool("record-route")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+			if recordRoute {
+				ipVersion = 4
+			}
+
+			includeHeader, err := cmd.Flags().GetBool("hdrincl")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+			if includeHeader {
+				ipVersion = 4
+			}
+
+			timestamp, err := cmd.Flags().GetBool("timestamp")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			mode := ModeICMP
+			if tcp {
+				mode = ModeTCP
+			} else if udp {
+				mode = ModeUDP
+			} else if timestamp {
+				mode = ModeTimestamp
+				ipVersion = 4
+			}
+
+			port, err := cmd.Flags().GetInt("port")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			opts := Options{
+				Mode:          mode,
+				Port:          port,
+				Count:         count,
+				Interval:      secondsToDuration(interval),
+				Timeout:       secondsToDuration(timeout),
+				Deadline:      secondsToDuration(deadline),
+				Size:          size,
+				Pattern:       pattern,
+				TTL:           ttl,
+				TOS:           tos,
+				RecordRoute:   recordRoute,
+				IncludeHeader: includeHeader,
+				IPVersion:     ipVersion,
+				Unprivileged:  unprivileged,
+				Concurrency:   concurrency,
+				Verbose:       verbose,
+			}
+			if err := opts.validate(); err != nil {
+				cmd.PrintErrln(err)
+				return
+			}
+			pinger := NewPinger(opts)
+			// Ctrl-C stops the run, after which the statistics gathered
+			// so far are printed.
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			// several hosts are swept, only a single one is pinged verbosely
+			if len(hosts) > 1 || sweep != "" || targetsFile != "" {
+				if _, err := pinger.Sweep(ctx, hosts); err != nil {
+					log.Printf("error sweeping hosts: %v", err)
+				}
+				return
+			}
+			if _, err := pinger.Ping(ctx, hosts[0]); err != nil {
 				log.Printf("error pinging host: %v", err)
 			}
 		},
 	}
-	pingCmd.Flags().IntP("count", "c", 3, "specify number of packets to send")
+	pingCmd.Flags().IntP("count", "c", 3, "specify number of packets to send, 0 to ping until interrupted")
+	pingCmd.Flags().Float64P("interval", "i", defaultInterval.Seconds(), "wait this many seconds between sending packets")
+	pingCmd.Flags().Float64P("timeout", "W", defaultTimeout.Seconds(), "time to wait for each reply, in seconds")
+	pingCmd.Flags().Float64P("deadline", "w", 0, "stop after this many seconds, regardless of how many packets were sent; unlike iputils, -c still stops after that many packets are sent, not received")
+	pingCmd.Flags().IntP("size", "s", defaultSize, "specify number of data bytes to send, at most 65507 over IPv4 and 65527 over IPv6")
+	pingCmd.Flags().StringP("pattern", "p", "", "fill the data bytes with this pattern of up to 16 hex bytes, eg: ff00")
+	pingCmd.Flags().Uint8P("ttl", "t", 0, "set the IP time to live (hop limit for IPv6)")
+	pingCmd.Flags().Uint8P("tos", "Q", 0, "set the IP type of service (traffic class for IPv6), eg: 184 for DSCP EF")
+	pingCmd.Flags().BoolP("ipv4", "4", false, "use IPv4 only")
+	pingCmd.Flags().BoolP("ipv6", "6", false, "use IPv6 only")
+	pingCmd.MarkFlagsMutuallyExclusive("ipv4", "ipv6")
+	pingCmd.Flags().Bool("tcp", false, "time TCP handshakes to --port instead of sending ICMP echo requests")
+	pingCmd.Flags().Bool("udp", false, "send UDP datagrams to --port instead of ICMP echo requests")
+	pingCmd.Flags().Bool("timestamp", false, "send ICMP timestamp requests and report the offset of the remote clock (IPv4 only)")
+	pingCmd.MarkFlagsMutuallyExclusive("tcp", "udp", "timestamp")
+	pingCmd.MarkFlagsMutuallyExclusive("timestamp", "ipv6")
+	pingCmd.Flags().BoolP("record-route", "R", false, "record the route taken by echo requests and their replies (IPv4 only)")
+	pingCmd.MarkFlagsMutuallyExclusive("record-route", "tcp", "udp", "timestamp")
+	pingCmd.MarkFlagsMutuallyExclusive("record-route", "ipv6")
+	pingCmd.Flags().Bool("hdrincl", false, "send echo requests along with their IPv4 header, so that the kernel doesn't build it (IPv4 only)")
+	pingCmd.MarkFlagsMutuallyExclusive("hdrincl", "tcp", "udp", "timestamp")
+	pingCmd.MarkFlagsMutuallyExclusive("hdrincl", "ipv6")
+	pingCmd.Flags().IntP("port", "P", defaultPort, "port to probe in TCP or UDP mode")
+	pingCmd.Flags().String("sweep", "", "ping every address in this network, eg: 192.168.1.0/24")
+	pingCmd.Flags().String("targets", "", "ping every host listed in this file, one per line")
+	pingCmd.Flags().Int("concurrency", defaultConcurrency, "number of hosts pinged at once when pinging several hosts")
+	pingCmd.Flags().Bool("unprivileged", false, "use ICMP datagram sockets, which don't require root (Linux only)")
 	pingCmd.Flags().BoolP("verbose", "v", false, "enable verbose mode to display detailed logs")
 
 	return pingCmd
 }
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
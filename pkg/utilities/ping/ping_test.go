@@ -0,0 +1,340 @@
+package ping
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/swagnikdutta/netprobe/pkg/dialer"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/icmp"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/ipv4"
+)
+
+// fakeDialer is a NetworkDialer whose packet connections are fakeConns.
+type fakeDialer struct {
+	dialer.Dialer
+	// privileged tells whether the connections act as raw sockets, which
+	// pass up IPv4 packets with their header, or as ICMP datagram sockets
+	privileged bool
+	// reply tells whether echo requests are answered
+	reply bool
+	// cancel, if set, is called instead of answering the request numbered
+	// cancelAfter, counting from 1
+	cancel      context.CancelFunc
+	cancelAfter int
+
+	mu       sync.Mutex
+	networks []string
+	conn     *fakeConn
+}
+
+func (d *fakeDialer) ListenPacket(network, address string) (dialer.PacketConn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.networks = append(d.networks, network)
+	d.conn = &fakeConn{
+		privileged:  d.privileged,
+		reply:       d.reply,
+		cancel:      d.cancel,
+		cancelAfter: d.cancelAfter,
+		replies:     make(chan reply, 16),
+		closed:      make(chan struct{}),
+	}
+	return d.conn, nil
+}
+
+type reply struct {
+	source net.IP
+	packet []byte
+}
+
+// fakeConn is a packet connection that answers the echo requests written to
+// it, if reply is set, with echo replies that are read back. The methods it
+// doesn't implement panic.
+type fakeConn struct {
+	dialer.PacketConn
+	privileged  bool
+	reply       bool
+	cancel      context.CancelFunc
+	cancelAfter int
+
+	mu       sync.Mutex
+	requests []*icmp.Packet
+
+	replies   chan reply
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *fakeConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	request, err := icmp.Parse(b)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, request)
+	n := len(c.requests)
+	c.mu.Unlock()
+	if c.cancel != nil && n == c.cancelAfter {
+		c.cancel()
+		return len(b), nil
+	}
+	if !c.reply {
+		return len(b), nil
+	}
+
+	// a stray reply to another process comes first
+	dest := addr.(*net.IPAddr).IP
+	for _, id := range []uint16{request.Header.Identifier + 1, request.Header.Identifier} {
+		_, packet, err := icmp.CreatePacket(icmp.TypeEchoReply, 0, 0, id, request.Header.SequenceNumber, request.Payload)
+		if err != nil {
+			return 0, err
+		}
+		if c.privileged {
+			_, packet, err = ipv4.CreatePacket(4, 5, 0, 0, 64, 1, 0, 1, 0, 0, dest, net.IPv4(127, 0, 0, 1), packet)
+			if err != nil {
+				return 0, err
+			}
+		}
+		c.replies <- reply{source: dest, packet: packet}
+	}
+	return len(b), nil
+}
+
+func (c *fakeConn) Read(b []byte) (int, error) {
+	n, _, err := c.ReadFrom(b)
+	return n, err
+}
+
+func (c *fakeConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case r := <-c.replies:
+		return copy(b, r.packet), &net.IPAddr{IP: r.source}, nil
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *fakeConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// LocalAddr returns the address of an ICMP datagram socket, whose port the
+// kernel uses as the echo identifier, or of a raw socket.
+func (c *fakeConn) LocalAddr() net.Addr {
+	if c.privileged {
+		return &net.IPAddr{IP: net.IPv4zero}
+	}
+	return &net.UDPAddr{IP: net.IPv4zero, Port: 0x4321}
+}
+
+func (c *fakeConn) sent() []*icmp.Packet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*icmp.Packet(nil), c.requests...)
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name       string
+		privileged bool
+		reply      bool
+		received   int
+		loss       float64
+	}{
+		{name: "raw socket", privileged: true, reply: true, received: 3},
+		{name: "datagram socket", reply: true, received: 3},
+		// unanswered probes are lost, they don't end the run
+		{name: "no reply", privileged: true, loss: 100},
+		{name: "no reply over a datagram socket", loss: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinger := NewPinger(Options{Count: 3, Interval: time.Millisecond, Timeout: 20 * time.Millisecond, Size: 16})
+			d := &fakeDialer{privileged: tt.privileged, reply: tt.reply}
+			pinger.dialer = d
+			pinger.privileged = tt.privileged
+
+			stats, err := pinger.Ping(context.Background(), "127.0.0.1")
+			require.NoError(t, err)
+			assert.Equal(t, 3, stats.PacketsSent)
+			assert.Equal(t, tt.received, stats.PacketsReceived)
+			assert.Len(t, stats.RTTs, tt.received)
+			assert.Zero(t, stats.Errors)
+			assert.Equal(t, tt.loss, stats.PacketLoss)
+
+			assert.Equal(t, []string{"ip4:icmp"}, d.networks)
+			requests := d.conn.sent()
+			require.Len(t, requests, 3)
+			for i, request := range requests {
+				assert.Equal(t, ICMPType, request.Header.Type)
+				assert.Equal(t, uint16(i), request.Header.SequenceNumber)
+				assert.Len(t, request.Payload, 16)
+				if tt.privileged {
+					assert.Equal(t, pinger.id, request.Header.Identifier)
+				}
+			}
+
+			// the socket is closed once the run is over
+			select {
+			case <-d.conn.closed:
+			default:
+				assert.Fail(t, "socket left open")
+			}
+		})
+	}
+}
+
+func TestPingDeadline(t *testing.T) {
+	// no probe is sent once the deadline has passed
+	pinger := NewPinger(Options{Interval: time.Millisecond, Timeout: time.Minute})
+	d := &fakeDialer{privileged: true, reply: true}
+	pinger.dialer = d
+	pinger.privileged = true
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	stats, err := pinger.Ping(ctx, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, stats.PacketsSent)
+	assert.Empty(t, d.conn.sent())
+}
+
+func TestReplyDeadline(t *testing.T) {
+	sentAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pinger := NewPinger(Options{Timeout: 10 * time.Second})
+
+	tests := []struct {
+		name        string
+		runDeadline time.Time
+		want        time.Time
+	}{
+		{"no deadline", time.Time{}, sentAt.Add(10 * time.Second)},
+		{"deadline past the timeout", sentAt.Add(time.Minute), sentAt.Add(10 * time.Second)},
+		// the wait for the last reply is cut short by the deadline
+		{"deadline before the timeout", sentAt.Add(time.Second), sentAt.Add(time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, pinger.replyDeadline(sentAt, tt.runDeadline))
+		})
+	}
+}
+
+func TestPingCancel(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		// deadline is far enough not to expire during the test, the run
+		// ending on the deadline or on cancellation alike
+		deadline time.Duration
+	}{
+		{name: "until cancelled"},
+		{name: "cancelled before count", count: 10},
+		{name: "cancelled before the deadline", deadline: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the third request is left unanswered, the run is cancelled
+			// while its reply is awaited
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			pinger := NewPinger(Options{Count: tt.count, Interval: time.Millisecond, Timeout: time.Hour, Deadline: tt.deadline})
+			d := &fakeDialer{privileged: true, reply: true, cancel: cancel, cancelAfter: 3}
+			pinger.dialer = d
+			pinger.privileged = true
+
+			stats, err := pinger.Ping(ctx, "127.0.0.1")
+			require.NoError(t, err)
+			assert.Equal(t, 3, stats.PacketsSent)
+			assert.Equal(t, 2, stats.PacketsReceived)
+			assert.Len(t, d.conn.sent(), 3)
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "defaults", opts: Options{Size: defaultSize}},
+		{name: "largest IPv4 size", opts: Options{IPVersion: 4, Size: 65507}},
+		{name: "largest IPv6 size", opts: Options{IPVersion: 6, Size: 65527}},
+		{name: "IPv4 size too large", opts: Options{IPVersion: 4, Size: 65508}, wantErr: true},
+		{name: "IPv6 size too large", opts: Options{Size: 65528}, wantErr: true},
+		{name: "negative size", opts: Options{Size: -1}, wantErr: true},
+		{name: "negative count", opts: Options{Count: -1}, wantErr: true},
+		{name: "negative interval", opts: Options{Interval: -time.Second}, wantErr: true},
+		{name: "negative timeout", opts: Options{Timeout: -time.Second}, wantErr: true},
+		{name: "negative deadline", opts: Options{Deadline: -time.Second}, wantErr: true},
+		{name: "negative concurrency", opts: Options{Concurrency: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPingCommandRejectsValues(t *testing.T) {
+	tests := [][]string{
+		{"-s", "-1"},
+		{"-s", "65528"},
+		{"-4", "-s", "65508"},
+		{"-c", "-1"},
+		{"-i", "-1"},
+		{"-W", "-1"},
+		{"-w", "-1"},
+		{"-t", "256"},
+		{"-t", "-1"},
+		{"--concurrency", "-1"},
+	}
+
+	for _, args := range tests {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			cmd := NewPingCommand()
+			var stderr bytes.Buffer
+			cmd.SetOut(&stderr)
+			cmd.SetErr(&stderr)
+			// nothing is sent to the address, which is reserved for
+			// documentation
+			cmd.SetArgs(append(args, "192.0.2.1"))
+
+			assert.NotPanics(t, func() {
+				err := cmd.Execute()
+				if err == nil {
+					assert.NotEmpty(t, stderr.String())
+				}
+			})
+		})
+	}
+}
+
+func TestPingSizeTooLargeForIPv4(t *testing.T) {
+	// the size is checked against the family of the host once resolved
+	pinger := NewPinger(Options{Count: 1, Size: 65508})
+	pinger.dialer = &fakeDialer{privileged: true}
+	pinger.privileged = true
+
+	_, err := pinger.Ping(context.Background(), "127.0.0.1")
+	assert.ErrorContains(t, err, "size")
+}
@@ -0,0 +1,194 @@
+package ping
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/icmp"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/ipv4"
+)
+
+var (
+	// minMTU is the smallest MTU every IPv4 link has to support (RFC 791)
+	minMTU = 68
+	// defaultMaxMTU is the largest path MTU probed by npctl pmtu, the MTU of Ethernet
+	defaultMaxMTU = 1500
+	// echoOverhead is the size of the IPv4 and ICMP headers of an echo request
+	echoOverhead = 28
+	// pmtuAttempts is the number of unanswered probes after which a packet
+	// size is assumed to be black-holed
+	pmtuAttempts = 3
+)
+
+// DiscoverPathMTU returns the size of the largest IPv4 packet that reaches host
+// without being fragmented, which is at most maxMTU.
+//
+// Echo requests are sent along with their IPv4 header, built with the Don't
+// Fragment flag set, and their size is binary searched. Routers that can't
+// forward a probe answer with an ICMP "fragmentation needed" error carrying
+// the MTU of their next hop, which is probed next. Probes that aren't answered
+// at all, as happens when those errors are filtered, are retried and then
+// considered too big.
+//
+// It requires a raw socket: ICMP datagram sockets aren't handed over those
+// errors. The settings of pinger are left untouched.
+func (pinger *Pinger) DiscoverPathMTU(ctx context.Context, host string, maxMTU int) (int, error) {
+	if maxMTU < minMTU {
+		return 0, errors.Errorf("maximum MTU can't be smaller than %d bytes", minMTU)
+	}
+	if !pinger.privileged {
+		return 0, errors.New("path MTU discovery requires a raw socket, run as root")
+	}
+
+	// probes are sent with a header of our own, with Don't Fragment set
+	pmtuPinger := *pinger
+	pinger = &pmtuPinger
+	pinger.ipVersion = 4
+	pinger.dontFragment = true
+	pinger.includeHeader = true
+	t, err := pinger.resolve(host)
+	if err != nil {
+		return 0, err
+	}
+
+	s, err := pinger.newSession(false)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	stop := closeOnCancel(ctx, s.conn)
+	defer stop()
+
+	fmt.Printf("\nDiscovering path MTU to %s (%v), at most %d bytes...\n\n", host, t.destIP, maxMTU)
+
+	// lo is the largest size known to get through, hi the largest size that may
+	lo, hi := minMTU, maxMTU
+	verified := false
+	size := hi
+	for {
+		fits, nextHopMTU, err := pinger.probeSize(ctx, s, t, size)
+		if err != nil {
+			return 0, err
+		}
+
+		if fits {
+			lo, verified = size, true
+		} else {
+			hi = size - 1
+			if nextHopMTU >= minMTU && nextHopMTU < hi {
+				hi = nextHopMTU
+			}
+		}
+
+		if lo >= hi {
+			if verified {
+				break
+			}
+			if size == minMTU {
+				return 0, errors.Errorf("no reply from %s, even to %d byte packets", host, minMTU)
+			}
+			size = minMTU
+			continue
+		}
+
+		size = (lo + hi + 1) / 2
+		// the MTU reported by a router is the most likely answer, try it first
+		if !fits && hi == nextHopMTU {
+			size = hi
+		}
+	}
+
+	fmt.Printf("\npath MTU to %s is %d bytes\n", host, lo)
+	return lo, nil
+}
+
+// probeSize sends echo requests of size bytes, IP header included, until one
+// of them is answered or pmtuAttempts have timed out. It reports whether the
+// packet got through and, if a router reported it as too big, the MTU of that
+// router's next hop.
+func (pinger *Pinger) probeSize(ctx context.Context, s *session, t *target, size int) (bool, int, error) {
+	for attempt := 0; attempt < pmtuAttempts; attempt++ {
+		sentAt := time.Now()
+		p, err := s.send(t, size-echoOverhead, sentAt)
+		if err == nil {
+			_, err = s.wait(p, sentAt.Add(pinger.timeout))
+		}
+		if ctx.Err() != nil {
+			return false, 0, ctx.Err()
+		}
+
+		var probeErr *probeError
+		switch {
+		case err == nil:
+			fmt.Printf("%d bytes: ok\n", size)
+			return true, 0, nil
+		case errors.Is(err, ipv4.ErrFragmentationNeeded), errors.Is(err, syscall.EMSGSIZE):
+			fmt.Printf("%d bytes: larger than the MTU of the outgoing interface\n", size)
+			return false, 0, nil
+		case errors.As(err, &probeErr):
+			m := probeErr.Message
+			if m.Type != icmp.TypeDestinationUnreachable || m.Code != icmp.CodeFragmentationNeeded {
+				return false, 0, probeErr
+			}
+			fmt.Printf("%d bytes: %v\n", size, probeErr)
+			return false, int(m.NextHopMTU), nil
+		case isTimeout(err):
+			fmt.Printf("%d bytes: no reply\n", size)
+		default:
+			return false, 0, err
+		}
+	}
+
+	return false, 0, nil
+}
+
+func NewPMTUCommand() *cobra.Command {
+	pmtuCmd := &cobra.Command{
+		Use:   "pmtu example.com",
+		Short: "discover the path MTU to a network host",
+		Long:  "\nThe pmtu utility discovers the largest IPv4 packet that reaches a host without being fragmented, by sending ICMP echo requests with the Don't Fragment flag set. It requires root",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			host := args[0]
+
+			maxMTU, err := cmd.Flags().GetInt("max")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			timeout, err := cmd.Flags().GetFloat64("timeout")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			verbose, err := cmd.Flags().GetBool("verbose")
+			if err != nil {
+				cmd.PrintErrln(err)
+			}
+
+			pinger := NewPinger(Options{
+				Timeout: secondsToDuration(timeout),
+				Verbose: verbose,
+			})
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			if _, err := pinger.DiscoverPathMTU(ctx, host, maxMTU); err != nil {
+				log.Printf("error discovering path MTU: %v", err)
+			}
+		},
+	}
+	pmtuCmd.Flags().Int("max", defaultMaxMTU, "largest path MTU to probe, in bytes")
+	pmtuCmd.Flags().Float64P("timeout", "W", defaultTimeout.Seconds(), "time to wait for each reply, in seconds")
+	pmtuCmd.Flags().BoolP("verbose", "v", false, "enable verbose mode to display detailed logs")
+
+	return pmtuCmd
+}
@@ -0,0 +1,51 @@
+package ping
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/ipv4"
+)
+
+func TestDiscoverPathMTUUnprivileged(t *testing.T) {
+	pinger := NewPinger(Options{Unprivileged: true})
+	_, err := pinger.DiscoverPathMTU(context.Background(), "192.0.2.1", defaultMaxMTU)
+	assert.ErrorContains(t, err, "raw socket")
+}
+
+func TestDiscoverPathMTUKeepsSettings(t *testing.T) {
+	pinger := NewPinger(Options{Size: 100, Timeout: time.Second})
+	// pretend to be root, resolving an IPv6 address fails first
+	pinger.privileged = true
+	before := *pinger
+
+	_, err := pinger.DiscoverPathMTU(context.Background(), "2001:db8::1", defaultMaxMTU)
+	assert.Error(t, err)
+	assert.Equal(t, before, *pinger)
+}
+
+func TestCreateEchoRequestDontFragment(t *testing.T) {
+	pinger := NewPinger(Options{})
+	pinger.dontFragment = true
+	pinger.includeHeader = true
+	target := &target{destIP: net.IP{192, 0, 2, 1}, sourceIP: net.IP{192, 0, 2, 2}, mtu: 1500}
+
+	_, packets, size, err := pinger.createEchoRequest(target, 1, 0, 1000-echoOverhead, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1000, size)
+	require.Len(t, packets, 1)
+
+	p, err := ipv4.Parse(packets[0])
+	require.NoError(t, err)
+	assert.Equal(t, ipv4.FlagDontFragment, p.Header.Flags)
+	assert.Equal(t, uint16(1000), p.Header.TotalLength)
+
+	// requests larger than the MTU of the interface aren't fragmented
+	target.mtu = 576
+	_, _, _, err = pinger.createEchoRequest(target, 1, 0, 1000-echoOverhead, time.Now())
+	assert.ErrorIs(t, err, ipv4.ErrFragmentationNeeded)
+}
@@ -0,0 +1,215 @@
+package ping
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/dialer"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/icmp"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/ipv4"
+)
+
+var errNotOurReply = errors.New("reply does not belong to this request")
+
+// echoReply holds the details of an ICMP echo reply that has been matched
+// against the echo request it answers.
+type echoReply struct {
+	Source         net.IP
+	TTL            uint8
+	Size           int
+	SequenceNumber uint16
+	// SentAt is the send timestamp echoed back in the payload, if any. It
+	// was read from the wall clock, which may have been stepped since, so
+	// it only stands in for the send time of replies whose probe is no
+	// longer pending.
+	SentAt     time.Time
+	ReceivedAt time.Time
+	// Route is the route recorded in the reply's Record Route option.
+	Route []net.IP
+	// Timestamps holds the timestamps of a Timestamp Reply.
+	Timestamps *icmp.TimestampMessage
+	// PortUnreachable is set when a UDP probe was answered with an ICMP
+	// Port Unreachable error, which proves that the host is up.
+	PortUnreachable bool
+	// ConnectionRefused is set when a TCP probe was answered with a reset,
+	// which proves that the host is up.
+	ConnectionRefused bool
+}
+
+// rtt returns the round-trip time of the reply to a request sent at sentAt,
+// the send time recorded for the probe. Unlike the timestamp echoed back in
+// the payload, it carries a monotonic clock reading, which isn't thrown off
+// when the wall clock is stepped during a run.
+func (r *echoReply) rtt(sentAt time.Time) time.Duration {
+	return r.ReceivedAt.Sub(sentAt)
+}
+
+// clockOffset estimates how far the clock of the host that sent a Timestamp
+// Reply is ahead of ours, assuming that the network delay is the same both
+// ways. It returns false if the reply carries non-standard timestamps.
+func (r *echoReply) clockOffset() (time.Duration, bool) {
+	ts := r.Timestamps
+	if ts == nil || !icmp.IsStandardTimestamp(ts.Receive) || !icmp.IsStandardTimestamp(ts.Transmit) {
+		return 0, false
+	}
+	received := icmp.Timestamp(r.ReceivedAt)
+	return (icmp.TimestampDiff(ts.Originate, ts.Receive) + icmp.TimestampDiff(received, ts.Transmit)) / 2, true
+}
+
+// oneWayDelays returns the delay of a Timestamp Reply's request on its way to
+// the remote host, and of the reply on its way back, as measured with both
+// clocks. Either includes the offset between the clocks.
+func (r *echoReply) oneWayDelays() (time.Duration, time.Duration) {
+	ts := r.Timestamps
+	return icmp.TimestampDiff(ts.Originate, ts.Receive), icmp.TimestampDiff(ts.Transmit, icmp.Timestamp(r.ReceivedAt))
+}
+
+// probeError is returned when a router, or the target itself, answered an
+// echo request with an ICMP error message instead of an echo reply.
+type probeError struct {
+	Source         net.IP
+	SequenceNumber uint16
+	Message        *icmp.ErrorMessage
+}
+
+func (e *probeError) Error() string {
+	return fmt.Sprintf("%s from %v", e.Message, e.Source)
+}
+
+// matchPacket decodes a raw IPv4 packet read from the socket and returns the
+// pending probe it answers. An echo reply is returned as is, an ICMP error
+// message quoting the probe is returned as a *probeError.
+//
+// A raw ip4:icmp socket receives every ICMP packet that reaches the host, so
+// anything else (replies to other processes, stale replies to earlier probes,
+// corrupted packets) doesn't match any probe and a nil probe is returned.
+func (s *session) matchPacket(packet []byte) (*probe, *echoReply, error) {
+	ipPacket, err := ipv4.Parse(dialer.RestoreIPv4Header(packet))
+	// The kernel records its own address in options such as Record Route
+	// once it has verified the checksum, without updating it.
+	if errors.Is(err, ipv4.ErrInvalidChecksum) && len(ipPacket.Header.Options) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := ipPacket.Header
+	if header.Protocol != ICMPProtocolNumber {
+		return nil, nil, errNotOurReply
+	}
+
+	p, reply, err := s.matchMessage(header.SourceIP, header.TTL, ipPacket.Payload)
+	if reply != nil {
+		for _, o := range header.Options {
+			if route, ok := o.(*ipv4.RouteOption); ok && route.OptionType == ipv4.OptionRecordRoute {
+				reply.Route = route.Recorded()
+			}
+		}
+	}
+	return p, reply, err
+}
+
+// matchMessage returns the pending probe answered by message, an ICMP or
+// ICMPv6 message received from source. It is used directly for sockets that
+// only pass up the ICMP message without the IP header, i.e. IPv6 raw sockets
+// and ICMP datagram sockets, in which case ttl is unknown and set to zero.
+func (s *session) matchMessage(source net.IP, ttl uint8, message []byte) (*probe, *echoReply, error) {
+	var packet *icmp.Packet
+	var err error
+	if s.ipv6 {
+		// the kernel has verified the checksum, which covers our address
+		packet, err = icmp.ParseV6(message, nil, nil)
+	} else {
+		packet, err = icmp.Parse(message)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if m, ok := packet.Body.(*icmp.ErrorMessage); ok {
+		return s.matchErrorMessage(source, m)
+	}
+
+	header := packet.Header
+	key := probeKey{
+		protocol: ICMPProtocolNumber,
+		id:       header.Identifier,
+		seq:      header.SequenceNumber,
+	}
+	if header.Code != 0 || key.id != s.id {
+		return nil, nil, errNotOurReply
+	}
+
+	p := s.lookup(key)
+	if p == nil || header.Type != p.replyType || !source.Equal(p.target.destIP) {
+		return nil, nil, errNotOurReply
+	}
+	if p = s.claim(key); p == nil {
+		return nil, nil, errNotOurReply
+	}
+
+	reply := &echoReply{
+		Source:         source,
+		TTL:            ttl,
+		Size:           len(message),
+		SequenceNumber: key.seq,
+	}
+	switch body := packet.Body.(type) {
+	case *icmp.TimestampMessage:
+		reply.Timestamps = body
+	case *icmp.EchoBody:
+		if sentAt, ok := s.pinger.parseTimestamp(body.Data); ok {
+			reply.SentAt = sentAt
+		}
+	}
+	return p, reply, nil
+}
+
+// matchErrorMessage returns the pending probe quoted by m, an ICMP or ICMPv6
+// error message, along with a *probeError describing it. The quoted datagram
+// is either one of our echo requests or one of our UDP probes.
+func (s *session) matchErrorMessage(source net.IP, m *icmp.ErrorMessage) (*probe, *echoReply, error) {
+	// the first 8 bytes of the original datagram are the header of our echo
+	// request, or of our UDP datagram
+	quoted := m.OriginalData
+	var key probeKey
+	switch m.OriginalProtocol() {
+	case ICMPProtocolNumber, icmp.ProtocolICMPv6:
+		key = probeKey{
+			protocol: ICMPProtocolNumber,
+			id:       binary.BigEndian.Uint16(quoted[4:6]),
+			seq:      binary.BigEndian.Uint16(quoted[6:8]),
+		}
+		isRequest := quoted[0] == ICMPType || quoted[0] == icmp.TypeTimestamp
+		if s.ipv6 {
+			isRequest = quoted[0] == icmp.TypeEchoRequestV6
+		}
+		if !isRequest || key.id != s.id {
+			return nil, nil, errNotOurReply
+		}
+	case UDPProtocolNumber:
+		key = probeKey{
+			protocol: UDPProtocolNumber,
+			id:       binary.BigEndian.Uint16(quoted[0:2]),
+			seq:      binary.BigEndian.Uint16(quoted[2:4]),
+		}
+	default:
+		return nil, nil, errNotOurReply
+	}
+
+	p := s.lookup(key)
+	if p == nil || !m.OriginalDestination().Equal(p.target.destIP) {
+		return nil, nil, errNotOurReply
+	}
+	if p = s.claim(key); p == nil {
+		return nil, nil, errNotOurReply
+	}
+	return p, nil, &probeError{
+		Source:         source,
+		SequenceNumber: key.seq,
+		Message:        m,
+	}
+}
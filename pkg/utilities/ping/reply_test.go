@@ -0,0 +1,132 @@
+package ping
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/icmp"
+)
+
+// newTestSession returns a session of identifier 0x1234, without a socket, in
+// which probes can be registered and replies matched.
+func newTestSession(ipv6 bool) *session {
+	return &session{
+		pinger:  NewPinger(Options{}),
+		ipv6:    ipv6,
+		id:      0x1234,
+		pending: make(map[probeKey]*probe),
+		closed:  make(chan struct{}),
+	}
+}
+
+// errorMessageV6 returns an ICMPv6 error message of type hType, sent by a
+// router, quoting an echo request of identifier id and sequence number seq
+// sent to dest.
+func errorMessageV6(hType, code uint8, dest net.IP, requestType uint8, id, seq uint16) []byte {
+	b := []byte{hType, code, 0, 0, 0, 0, 0x05, 0x00}
+	b = append(b, 0x60, 0, 0, 0, 0, 8, icmp.ProtocolICMPv6, 1)
+	b = append(b, net.ParseIP("2001:db8::1")...)
+	b = append(b, dest.To16()...)
+	return append(b, requestType, 0, 0, 0, byte(id>>8), byte(id), byte(seq>>8), byte(seq))
+}
+
+func TestMatchErrorMessageV6(t *testing.T) {
+	router := net.ParseIP("2001:db8::fe")
+	dest := net.ParseIP("2001:db8::2")
+
+	tests := []struct {
+		name        string
+		message     []byte
+		matched     bool
+		messageType uint8
+	}{
+		{
+			name:        "destination unreachable",
+			message:     errorMessageV6(icmp.TypeDestinationUnreachableV6, 3, dest, icmp.TypeEchoRequestV6, 0x1234, 7),
+			matched:     true,
+			messageType: icmp.TypeDestinationUnreachableV6,
+		},
+		{
+			name:        "packet too big",
+			message:     errorMessageV6(icmp.TypePacketTooBigV6, 0, dest, icmp.TypeEchoRequestV6, 0x1234, 7),
+			matched:     true,
+			messageType: icmp.TypePacketTooBigV6,
+		},
+		{
+			name:        "time exceeded",
+			message:     errorMessageV6(icmp.TypeTimeExceededV6, 0, dest, icmp.TypeEchoRequestV6, 0x1234, 7),
+			matched:     true,
+			messageType: icmp.TypeTimeExceededV6,
+		},
+		{
+			name:    "another identifier",
+			message: errorMessageV6(icmp.TypeTimeExceededV6, 0, dest, icmp.TypeEchoRequestV6, 0x4321, 7),
+		},
+		{
+			name:    "another sequence number",
+			message: errorMessageV6(icmp.TypeTimeExceededV6, 0, dest, icmp.TypeEchoRequestV6, 0x1234, 8),
+		},
+		{
+			name:    "another destination",
+			message: errorMessageV6(icmp.TypeTimeExceededV6, 0, net.ParseIP("2001:db8::3"), icmp.TypeEchoRequestV6, 0x1234, 7),
+		},
+		{
+			name:    "echo reply",
+			message: errorMessageV6(icmp.TypeTimeExceededV6, 0, dest, icmp.TypeEchoReplyV6, 0x1234, 7),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSession(true)
+			target := &target{destIP: dest}
+			key := probeKey{protocol: ICMPProtocolNumber, id: 0x1234, seq: 7}
+			pending := s.expect(target, key, time.Now())
+
+			p, reply, err := s.matchMessage(router, 0, tt.message)
+			assert.Nil(t, reply)
+			if !tt.matched {
+				assert.Nil(t, p)
+				assert.ErrorIs(t, err, errNotOurReply)
+				return
+			}
+
+			assert.Equal(t, pending, p)
+			var probeErr *probeError
+			require.ErrorAs(t, err, &probeErr)
+			assert.True(t, probeErr.Source.Equal(router))
+			assert.Equal(t, uint16(7), probeErr.SequenceNumber)
+			assert.Equal(t, tt.messageType, probeErr.Message.Type)
+			// a probe is answered once
+			assert.Nil(t, s.lookup(key))
+		})
+	}
+}
+
+func TestMatchEchoReplyV6(t *testing.T) {
+	s := newTestSession(true)
+	dest := net.ParseIP("2001:db8::2")
+	target := &target{destIP: dest}
+	pending := s.expect(target, probeKey{protocol: ICMPProtocolNumber, id: 0x1234, seq: 7}, time.Now())
+	pending.replyType = icmp.TypeEchoReplyV6
+
+	reply := []byte{icmp.TypeEchoReplyV6, 0, 0, 0, 0x12, 0x34, 0, 7, 'h', 'i'}
+	p, r, err := s.matchMessage(dest, 0, reply)
+	require.NoError(t, err)
+	assert.Equal(t, pending, p)
+	assert.Equal(t, uint16(7), r.SequenceNumber)
+	assert.Equal(t, len(reply), r.Size)
+}
+
+func TestRTTIgnoresWallClock(t *testing.T) {
+	sentAt := time.Now()
+	reply := &echoReply{
+		// the wall clock was stepped back an hour during the run
+		SentAt:     sentAt.Round(0).Add(time.Hour),
+		ReceivedAt: sentAt.Add(5 * time.Millisecond),
+	}
+	assert.Equal(t, 5*time.Millisecond, reply.rtt(sentAt))
+}
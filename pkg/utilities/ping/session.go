@@ -0,0 +1,514 @@
+package ping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/dialer"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/icmp"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/ipv4"
+	"github.com/swagnikdutta/netprobe/pkg/protocols/ipv6"
+)
+
+var (
+	errTimeout = errors.New("request timed out")
+
+	// recordRouteSlots is the number of addresses that fit in the Record
+	// Route option, which takes all the room left for options
+	recordRouteSlots = 9
+)
+
+// target is a host being pinged.
+type target struct {
+	// host is the name of the target, as given by the caller.
+	host string
+	// destIP is the resolved address of host.
+	destIP net.IP
+	// sourceIP is the local address used to reach destIP.
+	sourceIP net.IP
+	// mtu is the MTU of the interface sourceIP belongs to, which echo
+	// requests are fragmented to when their IPv4 header is included.
+	mtu int
+}
+
+func (t *target) isIPv6() bool {
+	return t.destIP.To4() == nil
+}
+
+// prober sends probes to targets and waits for them to be answered.
+type prober interface {
+	// probe sends probe number seq of a run to t at sentAt, and waits until
+	// deadline, or until ctx is done, for it to be answered. A probe that
+	// isn't answered in time returns errTimeout. Every probe sent is printed
+	// if verbose is set.
+	probe(ctx context.Context, t *target, seq uint16, sentAt, deadline time.Time, verbose bool) (*echoReply, error)
+
+	// printReply prints the answer to a probe, which took rtt to arrive.
+	printReply(reply *echoReply, rtt time.Duration)
+}
+
+// probeKey identifies a probe, and the replies to it. For ICMP echo requests,
+// id and seq are the identifier and sequence number. For UDP probes, they are
+// the source and destination ports.
+type probeKey struct {
+	protocol uint8
+	id       uint16
+	seq      uint16
+}
+
+// probe is a probe waiting for its reply.
+type probe struct {
+	key    probeKey
+	target *target
+	// header is the header of the ICMP request sent, nil for UDP probes
+	header *icmp.Header
+	// replyType is the type of the ICMP message answering the request
+	replyType uint8
+	// size is the size of the whole IP packet
+	size   int
+	sentAt time.Time
+	result chan probeResult
+}
+
+type probeResult struct {
+	reply *echoReply
+	err   error
+}
+
+// session owns the socket shared by all the echo requests of a run, in a
+// single address family. Every packet received on the socket is matched
+// against the pending probes by its identifier and sequence number, and
+// handed to the probe it answers. This lets many targets be pinged at once
+// without opening a socket per target.
+type session struct {
+	pinger *Pinger
+	conn   dialer.PacketConn
+	ipv6   bool
+	id     uint16
+
+	mu      sync.Mutex
+	seq     uint16
+	pending map[probeKey]*probe
+
+	// closed is closed once the socket can't be read from anymore, with
+	// the reason stored in readErr.
+	closed  chan struct{}
+	readErr error
+}
+
+// newSession opens the socket used to send echo requests and receive replies
+// over IPv4, or IPv6 if ipv6 is set.
+//
+// The socket is left unconnected: a connected raw socket only receives
+// packets sent by the destination, which would hide ICMP errors sent by
+// routers along the way.
+func (pinger *Pinger) newSession(ipv6 bool) (*session, error) {
+	var conn dialer.PacketConn
+	var err error
+	if ipv6 {
+		conn, err = pinger.dialer.ListenPacket("ip6:ipv6-icmp", "::")
+	} else {
+		conn, err = pinger.dialer.ListenPacket("ip4:icmp", "0.0.0.0")
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening ICMP socket")
+	}
+
+	if err := pinger.setSocketOptions(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s := &session{
+		pinger:  pinger,
+		conn:    conn,
+		ipv6:    ipv6,
+		id:      pinger.id,
+		pending: make(map[probeKey]*probe),
+		closed:  make(chan struct{}),
+	}
+	// ICMP datagram sockets overwrite the echo identifier with their local
+	// port, replies have to be matched against it
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		s.id = uint16(addr.Port)
+	}
+
+	go s.readReplies()
+	return s, nil
+}
+
+func (pinger *Pinger) setSocketOptions(conn dialer.PacketConn) error {
+	// the header written along with echo requests carries every setting
+	if pinger.includeHeader {
+		if err := dialer.SetHeaderIncluded(conn); err != nil {
+			return errors.Wrapf(err, "error enabling IP_HDRINCL")
+		}
+		return nil
+	}
+	if pinger.ttl != 0 {
+		if err := dialer.SetTTL(conn, int(pinger.ttl)); err != nil {
+			return errors.Wrapf(err, "error setting TTL")
+		}
+	}
+	if pinger.tos != 0 {
+		if err := dialer.SetTOS(conn, int(pinger.tos)); err != nil {
+			return errors.Wrapf(err, "error setting type of service")
+		}
+	}
+	if options := pinger.ipOptions(); options != nil {
+		optionsSerialized, err := ipv4.SerializeOptions(options)
+		if err != nil {
+			return errors.Wrapf(err, "error serializing IP options")
+		}
+		if err := dialer.SetIPOptions(conn, optionsSerialized); err != nil {
+			return errors.Wrapf(err, "error setting IP options")
+		}
+	}
+	return nil
+}
+
+// ipOptions returns the options of the IPv4 header of echo requests, which
+// the kernel adds on our behalf unless the header is included.
+func (pinger *Pinger) ipOptions() []ipv4.Option {
+	if !pinger.recordRoute {
+		return nil
+	}
+	return []ipv4.Option{ipv4.NewRecordRouteOption(recordRouteSlots)}
+}
+
+func (s *session) Close() error {
+	return s.conn.Close()
+}
+
+// headerIncluded reports whether IPv4 packets are read from the socket
+// along with their IP header, which is the case for raw sockets.
+func (s *session) headerIncluded() bool {
+	return s.pinger.privileged && !s.ipv6
+}
+
+// send creates a request to t, sent at sentAt, and writes it to the socket.
+// The request is an echo request carrying size bytes of data, or a timestamp
+// request in ModeTimestamp.
+func (s *session) send(t *target, size int, sentAt time.Time) (*probe, error) {
+	s.mu.Lock()
+	seq := s.seq
+	s.seq++
+	s.mu.Unlock()
+
+	var header *icmp.Header
+	var packets [][]byte
+	var ipSize int
+	replyType := ICMPEchoReplyType
+	if s.pinger.mode == ModeTimestamp {
+		request, serialized, err := icmp.CreateTimestampMessage(icmp.TypeTimestamp, ICMPCode, s.id, seq, icmp.Timestamp(sentAt), 0, 0)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating ICMP timestamp request")
+		}
+		header, packets, ipSize = request.Header, [][]byte{serialized}, int(IHL)*4+len(serialized)
+		replyType = icmp.TypeTimestampReply
+	} else {
+		request, serialized, n, err := s.pinger.createEchoRequest(t, s.id, seq, size, sentAt)
+		if err != nil {
+			return nil, err
+		}
+		header, packets, ipSize = request.Header, serialized, n
+		if s.ipv6 {
+			replyType = icmp.TypeEchoReplyV6
+		}
+	}
+
+	key := probeKey{
+		protocol: ICMPProtocolNumber,
+		id:       header.Identifier,
+		seq:      header.SequenceNumber,
+	}
+	p := s.expect(t, key, sentAt)
+	p.header = header
+	p.replyType = replyType
+	p.size = ipSize
+
+	for _, packet := range packets {
+		if _, err := s.conn.WriteTo(packet, &net.IPAddr{IP: t.destIP}); err != nil {
+			s.forget(p)
+			return nil, errors.Wrapf(err, "error sending ICMP request")
+		}
+	}
+	return p, nil
+}
+
+// expect registers a probe to t, identified by key and sent at sentAt, as
+// waiting for its reply. It must be registered before the probe is sent, so
+// that a quick reply isn't mistaken for a stray packet.
+func (s *session) expect(t *target, key probeKey, sentAt time.Time) *probe {
+	p := &probe{
+		key:    key,
+		target: t,
+		sentAt: sentAt,
+		result: make(chan probeResult, 1),
+	}
+	s.mu.Lock()
+	s.pending[key] = p
+	s.mu.Unlock()
+	return p
+}
+
+// probe sends an ICMP request to t and waits for the reply. The sequence
+// number of the request is picked by the session rather than taken from seq,
+// so that it is unique among all the targets sharing the session.
+func (s *session) probe(ctx context.Context, t *target, seq uint16, sentAt, deadline time.Time, verbose bool) (*echoReply, error) {
+	p, err := s.send(t, s.pinger.size, sentAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if verbose {
+		kind := "echo"
+		if s.pinger.mode == ModeTimestamp {
+			kind = "timestamp"
+		}
+		fmt.Printf("sent ICMP %s request (%v bytes) from %v, to %v, identifier: %v, seq_no: %v\n",
+			kind,
+			p.size,
+			t.sourceIP,
+			t.destIP,
+			p.header.Identifier,
+			p.header.SequenceNumber,
+		)
+	}
+	return s.wait(p, deadline)
+}
+
+func (s *session) printReply(reply *echoReply, rtt time.Duration) {
+	defer printRoute(reply.Route)
+
+	if ts := reply.Timestamps; ts != nil {
+		fmt.Printf("received ICMP timestamp reply from %v, seq no: %v, originate: %v, receive: %v, transmit: %v, time: %s ms\n",
+			reply.Source,
+			reply.SequenceNumber,
+			ts.Originate,
+			ts.Receive,
+			ts.Transmit,
+			formatMillis(rtt),
+		)
+		if offset, ok := reply.clockOffset(); ok {
+			outbound, inbound := reply.oneWayDelays()
+			fmt.Printf("clock offset: %s ms, one-way delay: %s ms there, %s ms back\n\n",
+				formatMillis(offset),
+				formatMillis(outbound),
+				formatMillis(inbound),
+			)
+		} else {
+			fmt.Printf("remote timestamps aren't in milliseconds since midnight UT\n\n")
+		}
+		return
+	}
+
+	fmt.Printf("received ICMP echo packet (%v bytes) from %v, seq no: %v, ", reply.Size, reply.Source, reply.SequenceNumber)
+	// the TTL isn't known when the socket doesn't pass up the IP header
+	if reply.TTL != 0 {
+		fmt.Printf("ttl: %v, ", reply.TTL)
+	}
+	fmt.Printf("time: %s ms\n\n", formatMillis(rtt))
+}
+
+// wait blocks until p is answered, or until deadline. If p is answered by an
+// ICMP error message, a *probeError is returned.
+func (s *session) wait(p *probe, deadline time.Time) (*echoReply, error) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case result := <-p.result:
+		return result.reply, result.err
+	case <-timer.C:
+		s.forget(p)
+		return nil, errTimeout
+	case <-s.closed:
+		s.forget(p)
+		return nil, s.readErr
+	}
+}
+
+func (s *session) forget(p *probe) {
+	s.mu.Lock()
+	delete(s.pending, p.key)
+	s.mu.Unlock()
+}
+
+// lookup returns the pending probe with the given key, or nil if there is no
+// such probe.
+func (s *session) lookup(key probeKey) *probe {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pending[key]
+}
+
+// claim removes the probe with the given key from the pending probes and
+// returns it, or nil if there is no such probe.
+func (s *session) claim(key probeKey) *probe {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.pending[key]
+	if ok {
+		delete(s.pending, key)
+	}
+	return p
+}
+
+// readReplies reads packets from the socket until it is closed, and hands
+// each of them to the probe it answers. Packets that don't answer any
+// pending probe are discarded.
+func (s *session) readReplies() {
+	defer close(s.closed)
+
+	// the largest possible IP packet
+	buf := make([]byte, 65535)
+	for {
+		var p *probe
+		var reply *echoReply
+		var err error
+		if s.headerIncluded() {
+			n, readErr := s.conn.Read(buf)
+			if readErr != nil {
+				s.readErr = errors.Wrapf(readErr, "error receiving ICMP echo response")
+				return
+			}
+			p, reply, err = s.matchPacket(buf[:n])
+		} else {
+			n, addr, readErr := s.conn.ReadFrom(buf)
+			if readErr != nil {
+				s.readErr = errors.Wrapf(readErr, "error receiving ICMP echo response")
+				return
+			}
+			p, reply, err = s.matchMessage(addr.(*net.IPAddr).IP, 0, buf[:n])
+		}
+		receivedAt := time.Now()
+
+		if p == nil {
+			continue
+		}
+		if reply != nil {
+			reply.ReceivedAt = receivedAt
+		}
+		p.result <- probeResult{reply: reply, err: err}
+	}
+}
+
+// createEchoRequest creates the echo request to t with identifier id and
+// sequence number seq, carrying size bytes of data, sent at sentAt. It returns the ICMP packet, the packets
+// to be written on the socket and the size of the whole IP packet. There is a
+// single packet to write, unless an IPv4 header is included and the request
+// is fragmented.
+func (pinger *Pinger) createEchoRequest(t *target, id, seq uint16, size int, sentAt time.Time) (*icmp.Packet, [][]byte, int, error) {
+	payload := pinger.createPayload(size, sentAt)
+	ttl := pinger.ttl
+	if ttl == 0 {
+		ttl = HopLimit
+	}
+
+	if t.isIPv6() {
+		icmpPacket, icmpSerialized, err := icmp.CreateV6Packet(
+			icmp.TypeEchoRequestV6,
+			ICMPCode,
+			id,
+			seq,
+			t.sourceIP,
+			t.destIP,
+			payload,
+		)
+		if err != nil {
+			return nil, nil, 0, errors.Wrapf(err, "error creating ICMPv6 packet")
+		}
+
+		// IPv6 sockets don't accept a user supplied IPv6 header, only the
+		// ICMPv6 packet is sent, the kernel prepends the header.
+		ipPacket, _, err := ipv6.CreatePacket(pinger.tos, icmp.ProtocolICMPv6, ttl, 0, t.sourceIP, t.destIP, icmpSerialized)
+		if err != nil {
+			return nil, nil, 0, errors.Wrapf(err, "error creating IPv6 packet")
+		}
+		return icmpPacket, [][]byte{icmpSerialized}, ipv6.HeaderSize + int(ipPacket.Header.PayloadLength), nil
+	}
+
+	icmpPacket, icmpSerialized, err := icmp.CreatePacket(
+		ICMPType,
+		ICMPCode,
+		0,
+		id,
+		seq,
+		payload,
+	)
+	if err != nil {
+		return nil, nil, 0, errors.Wrapf(err, "error creating ICMP packet")
+	}
+
+	var flags uint8
+	if pinger.dontFragment {
+		flags |= ipv4.FlagDontFragment
+	}
+	// The kernel picks an identification of its own for every packet
+	// written with a zero one, which would tell the fragments apart.
+	identification := seq + 1
+	if identification == 0 {
+		identification = 1
+	}
+
+	ipPacket, _, err := ipv4.CreatePacket(
+		Version,
+		IHL,
+		pinger.tos,
+		flags,
+		ttl,
+		ICMPProtocolNumber,
+		0,
+		identification,
+		0,
+		0,
+		t.sourceIP,
+		t.destIP,
+		icmpSerialized,
+		pinger.ipOptions()...,
+	)
+	if err != nil {
+		return nil, nil, 0, errors.Wrapf(err, "error creating IPv4 packet")
+	}
+	if pinger.includeHeader {
+		// the kernel doesn't fragment packets whose header is included
+		fragments, err := ipv4.Fragment(ipPacket, t.mtu)
+		if err != nil {
+			return nil, nil, 0, errors.Wrapf(err, "error fragmenting IPv4 packet")
+		}
+		var packets [][]byte
+		for _, fragment := range fragments {
+			b, err := fragment.Serialize()
+			if err != nil {
+				return nil, nil, 0, errors.Wrapf(err, "error serializing IPv4 fragment")
+			}
+			packets = append(packets, b)
+		}
+		return icmpPacket, packets, int(ipPacket.Header.TotalLength), nil
+	}
+	// Otherwise, the kernel prepends its own IP header, built from the socket options,
+	// to the ICMP packet written on the socket. The IPv4 packet built above
+	// only serves to account for its size.
+	return icmpPacket, [][]byte{icmpSerialized}, int(ipPacket.Header.TotalLength), nil
+}
+
+// printRoute prints the route recorded in a reply, as iputils ping does.
+func printRoute(route []net.IP) {
+	for i, hop := range route {
+		if i == 0 {
+			fmt.Printf("RR: \t%v\n", hop)
+			continue
+		}
+		fmt.Printf("\t%v\n", hop)
+	}
+	if len(route) > 0 {
+		fmt.Println()
+	}
+}
@@ -0,0 +1,161 @@
+package ping
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+// Statistics summarises a ping run. It carries the same numbers that are
+// printed at the end of a run, so that callers don't have to scrape stdout.
+type Statistics struct {
+	// Host is the name that was pinged, as given by the caller.
+	Host string
+	// IP is the resolved address of Host.
+	IP net.IP
+
+	PacketsSent     int
+	PacketsReceived int
+	// Errors is the number of probes that were answered with an ICMP
+	// error message, such as Destination Unreachable.
+	Errors int
+	// PacketLoss is the percentage of sent packets that were not answered.
+	PacketLoss float64
+
+	// RTTs holds the round-trip time of every answered probe, in the
+	// order they were received.
+	RTTs   []time.Duration
+	MinRTT time.Duration
+	AvgRTT time.Duration
+	MaxRTT time.Duration
+	// StdDevRTT is the mean deviation of the round-trip times, reported
+	// as "mdev" by iputils ping.
+	StdDevRTT time.Duration
+
+	// ClockOffsets holds how far the clock of the host was ahead of ours,
+	// as estimated from every timestamp reply. It is only set in ModeTimestamp.
+	ClockOffsets []time.Duration
+
+	// Elapsed is the wall clock time spent on the whole run.
+	Elapsed time.Duration
+}
+
+func (s *Statistics) addRTT(rtt time.Duration) {
+	s.PacketsReceived++
+	s.RTTs = append(s.RTTs, rtt)
+}
+
+// finish records the time elapsed since start and computes the summary.
+func (s *Statistics) finish(start time.Time) *Statistics {
+	s.Elapsed = time.Since(start)
+	s.compute()
+	return s
+}
+
+// compute derives the loss percentage and the min/avg/max/mdev values
+// from the collected round-trip times.
+func (s *Statistics) compute() {
+	if s.PacketsSent > 0 {
+		s.PacketLoss = float64(s.PacketsSent-s.PacketsReceived) / float64(s.PacketsSent) * 100
+	}
+	if len(s.RTTs) == 0 {
+		return
+	}
+
+	var sum, sumSquares float64
+	s.MinRTT, s.MaxRTT = s.RTTs[0], s.RTTs[0]
+	for _, rtt := range s.RTTs {
+		if rtt < s.MinRTT {
+			s.MinRTT = rtt
+		}
+		if rtt > s.MaxRTT {
+			s.MaxRTT = rtt
+		}
+		sum += float64(rtt)
+		sumSquares += float64(rtt) * float64(rtt)
+	}
+
+	// mdev is computed the way iputils does it: sqrt(E[rtt^2] - E[rtt]^2)
+	n := float64(len(s.RTTs))
+	mean := sum / n
+	s.AvgRTT = time.Duration(mean)
+	s.StdDevRTT = time.Duration(math.Sqrt(math.Max(sumSquares/n-mean*mean, 0)))
+}
+
+// String renders the statistics in the format used by iputils ping.
+func (s *Statistics) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "--- %s ping statistics ---\n", s.Host)
+	fmt.Fprintf(&sb, "%d packets transmitted, %d received, ", s.PacketsSent, s.PacketsReceived)
+	if s.Errors > 0 {
+		fmt.Fprintf(&sb, "+%d errors, ", s.Errors)
+	}
+	fmt.Fprintf(&sb, "%s%% packet loss, time %dms\n",
+		formatLoss(s.PacketLoss),
+		s.Elapsed.Milliseconds(),
+	)
+	if len(s.RTTs) > 0 {
+		fmt.Fprintf(&sb, "rtt min/avg/max/mdev = %s/%s/%s/%s ms\n",
+			formatMillis(s.MinRTT),
+			formatMillis(s.AvgRTT),
+			formatMillis(s.MaxRTT),
+			formatMillis(s.StdDevRTT),
+		)
+	}
+	if len(s.ClockOffsets) > 0 {
+		minOffset, maxOffset := s.ClockOffsets[0], s.ClockOffsets[0]
+		var sum time.Duration
+		for _, offset := range s.ClockOffsets {
+			if offset < minOffset {
+				minOffset = offset
+			}
+			if offset > maxOffset {
+				maxOffset = offset
+			}
+			sum += offset
+		}
+		fmt.Fprintf(&sb, "clock offset min/avg/max = %s/%s/%s ms\n",
+			formatMillis(minOffset),
+			formatMillis(sum/time.Duration(len(s.ClockOffsets))),
+			formatMillis(maxOffset),
+		)
+	}
+
+	return sb.String()
+}
+
+// Summary renders the statistics on a single line, as fping does at the end
+// of a sweep.
+func (s *Statistics) Summary() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%s : xmt/rcv/%%loss = %d/%d/%s%%",
+		s.Host,
+		s.PacketsSent,
+		s.PacketsReceived,
+		formatLoss(s.PacketLoss),
+	)
+	if len(s.RTTs) > 0 {
+		fmt.Fprintf(&sb, ", min/avg/max = %s/%s/%s",
+			formatMillis(s.MinRTT),
+			formatMillis(s.AvgRTT),
+			formatMillis(s.MaxRTT),
+		)
+	}
+
+	return sb.String()
+}
+
+func formatMillis(d time.Duration) string {
+	return fmt.Sprintf("%.3f", float64(d)/float64(time.Millisecond))
+}
+
+func formatLoss(loss float64) string {
+	if loss == math.Trunc(loss) {
+		return fmt.Sprintf("%.0f", loss)
+	}
+	return fmt.Sprintf("%.4g", loss)
+}
@@ -0,0 +1,193 @@
+package ping
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// defaultConcurrency is the number of hosts pinged at once during a sweep.
+	defaultConcurrency = 64
+	// maxSweepSize is the largest number of addresses a sweep can expand to.
+	maxSweepSize = 65536
+)
+
+// Sweep pings every host in hosts, at most pinger.concurrency of them at once,
+// and reports whether each of them is alive as soon as it is done with. The
+// ICMP echo requests of every host are sent over the same socket, one per
+// address family, and replies are told apart by their identifier and sequence
+// number.
+//
+// The returned Statistics are in the same order as hosts. Hosts that couldn't
+// be resolved have no statistics, and a nil entry.
+func (pinger *Pinger) Sweep(ctx context.Context, hosts []string) ([]*Statistics, error) {
+	if pinger.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pinger.deadline)
+		defer cancel()
+	}
+
+	// the resolver isn't safe for concurrent use, targets are resolved
+	// before any of them is pinged
+	targets := make([]*target, len(hosts))
+	var probers [2]prober
+	for i, host := range hosts {
+		t, err := pinger.resolve(host)
+		if err != nil {
+			fmt.Printf("%s: %v\n", host, err)
+			continue
+		}
+		targets[i] = t
+
+		family := 0
+		if t.isIPv6() {
+			family = 1
+		}
+		if probers[family] != nil {
+			continue
+		}
+		p, closeProber, err := pinger.newProber(ctx, t.isIPv6())
+		if err != nil {
+			return nil, err
+		}
+		defer closeProber()
+		probers[family] = p
+	}
+
+	fmt.Printf("\nPinging %d hosts...\n\n", len(hosts))
+
+	results := make([]*Statistics, len(hosts))
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	jobs := make(chan int)
+	for w := 0; w < pinger.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				t := targets[i]
+				p := probers[0]
+				if t.isIPv6() {
+					p = probers[1]
+				}
+
+				stats, err := pinger.run(ctx, p, t, false)
+				if err != nil && ctx.Err() == nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+				results[i] = stats
+
+				if stats.PacketsReceived > 0 {
+					fmt.Printf("%s is alive\n", t.host)
+				} else {
+					fmt.Printf("%s is unreachable\n", t.host)
+				}
+			}
+		}()
+	}
+
+	for i, t := range targets {
+		if t == nil {
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	fmt.Println()
+	for _, stats := range results {
+		if stats != nil {
+			fmt.Println(stats.Summary())
+		}
+	}
+	return results, firstErr
+}
+
+// expandCIDR returns every address in the network cidr, eg: "192.168.1.0/24".
+// The network and broadcast addresses of IPv4 networks are left out, except
+// for /31 and /32 networks, which don't have any.
+func expandCIDR(cidr string) ([]string, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing network %q", cidr)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		network.IP = network.IP.To4()
+	}
+
+	ones, bits := network.Mask.Size()
+	hostBits := bits - ones
+	// hostBits is compared first as shifting past the size of an int would
+	// overflow
+	if hostBits >= 31 || 1<<hostBits > maxSweepSize {
+		return nil, errors.Errorf("network %s has more than %d addresses", cidr, maxSweepSize)
+	}
+
+	var hosts []string
+	ip = append(net.IP(nil), network.IP...)
+	for network.Contains(ip) {
+		hosts = append(hosts, ip.String())
+		ip = nextIP(ip)
+	}
+
+	if bits == 8*net.IPv4len && hostBits >= 2 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// nextIP returns the address that follows ip, wrapping around to zero.
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP(nil), ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// readTargets reads the hosts listed in the file at path, one per line. Blank
+// lines and lines starting with '#' are skipped.
+func readTargets(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening targets file")
+	}
+	defer f.Close()
+
+	var hosts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "error reading targets file")
+	}
+	return hosts, nil
+}
@@ -0,0 +1,40 @@
+package ping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandCIDR(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		hosts   int
+		first   string
+		wantErr bool
+	}{
+		{cidr: "192.0.2.0/30", hosts: 2, first: "192.0.2.1"},
+		{cidr: "192.0.2.0/31", hosts: 2, first: "192.0.2.0"},
+		{cidr: "192.0.2.7/32", hosts: 1, first: "192.0.2.7"},
+		{cidr: "10.0.0.0/16", hosts: 65534, first: "10.0.0.1"},
+		{cidr: "10.0.0.0/15", wantErr: true},
+		{cidr: "2001:db8::/112", hosts: 65536, first: "2001:db8::"},
+		{cidr: "2001:db8::/111", wantErr: true},
+		{cidr: "::/0", wantErr: true},
+		{cidr: "192.0.2.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			hosts, err := expandCIDR(tt.cidr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, hosts, tt.hosts)
+			assert.Equal(t, tt.first, hosts[0])
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package ping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultPort is the port probed by npctl ping --tcp and --udp.
+var defaultPort = 80
+
+// connectError is returned when a probe was actively turned down by a router
+// reporting the target as unreachable.
+type connectError struct {
+	Address        string
+	SequenceNumber uint16
+	Err            syscall.Errno
+}
+
+func (e *connectError) Error() string {
+	return fmt.Sprintf("%v from %s", e.Err, e.Address)
+}
+
+// tcpProber times the TCP handshake to a port of the target. It is meant for
+// hosts that sit behind firewalls dropping ICMP.
+type tcpProber struct {
+	pinger *Pinger
+	port   int
+}
+
+// probe connects to the port of t and closes the connection as soon as it is
+// established.
+func (p *tcpProber) probe(ctx context.Context, t *target, seq uint16, sentAt, deadline time.Time, verbose bool) (*echoReply, error) {
+	address := net.JoinHostPort(t.destIP.String(), strconv.Itoa(p.port))
+	if verbose {
+		fmt.Printf("sent TCP connection request from %v, to %s, seq_no: %v\n", t.sourceIP, address, seq)
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	conn, err := p.pinger.dialer.DialContext(ctx, "tcp", address)
+	receivedAt := time.Now()
+	// a refused connection was answered by the target, which proves that it
+	// is up
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return &echoReply{
+			Source:            t.destIP,
+			SequenceNumber:    seq,
+			ReceivedAt:        receivedAt,
+			ConnectionRefused: true,
+		}, nil
+	}
+	if err != nil {
+		for _, errno := range []syscall.Errno{syscall.EHOSTUNREACH, syscall.ENETUNREACH} {
+			if errors.Is(err, errno) {
+				return nil, &connectError{Address: address, SequenceNumber: seq, Err: errno}
+			}
+		}
+		if isTimeout(err) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, errTimeout
+		}
+		return nil, errors.Wrapf(err, "error connecting to %s", address)
+	}
+	conn.Close()
+
+	return &echoReply{
+		Source:         t.destIP,
+		SequenceNumber: seq,
+		ReceivedAt:     receivedAt,
+	}, nil
+}
+
+func (p *tcpProber) printReply(reply *echoReply, rtt time.Duration) {
+	if reply.ConnectionRefused {
+		fmt.Printf("connection refused by %v port %d, seq no: %v, time: %s ms\n\n", reply.Source, p.port, reply.SequenceNumber, formatMillis(rtt))
+		return
+	}
+	fmt.Printf("connected to %v port %d, seq no: %v, time: %s ms\n\n", reply.Source, p.port, reply.SequenceNumber, formatMillis(rtt))
+}
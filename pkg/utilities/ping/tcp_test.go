@@ -0,0 +1,84 @@
+package ping
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/swagnikdutta/netprobe/pkg/dialer"
+)
+
+// connectDialer is a NetworkDialer whose connections fail with err, or
+// succeed if err is nil.
+type connectDialer struct {
+	dialer.Dialer
+	err error
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", d.err)}
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func TestTCPProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		received  int
+		errors    int
+		wantError bool
+	}{
+		{name: "connected", received: 1},
+		{name: "refused", err: syscall.ECONNREFUSED, received: 1},
+		{name: "host unreachable", err: syscall.EHOSTUNREACH, errors: 1},
+		{name: "network unreachable", err: syscall.ENETUNREACH, errors: 1},
+		{name: "timed out", err: syscall.ETIMEDOUT},
+		{name: "other error", err: syscall.EACCES, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinger := NewPinger(Options{Mode: ModeTCP, Count: 1})
+			pinger.dialer = &connectDialer{err: tt.err}
+			p, closeProber, err := pinger.newProber(context.Background(), false)
+			require.NoError(t, err)
+			defer closeProber()
+
+			target := &target{host: "192.0.2.1", destIP: net.IPv4(192, 0, 2, 1), sourceIP: net.IPv4(192, 0, 2, 2)}
+			stats, err := pinger.run(context.Background(), p, target, false)
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, stats.PacketsSent)
+			assert.Equal(t, tt.received, stats.PacketsReceived)
+			assert.Equal(t, tt.errors, stats.Errors)
+			assert.Len(t, stats.RTTs, tt.received)
+		})
+	}
+}
+
+func TestTCPProbeRefused(t *testing.T) {
+	pinger := NewPinger(Options{Mode: ModeTCP})
+	pinger.dialer = &connectDialer{err: syscall.ECONNREFUSED}
+	p := &tcpProber{pinger: pinger, port: 80}
+
+	target := &target{host: "192.0.2.1", destIP: net.IPv4(192, 0, 2, 1), sourceIP: net.IPv4(192, 0, 2, 2)}
+	sentAt := time.Now()
+	reply, err := p.probe(context.Background(), target, 3, sentAt, sentAt.Add(time.Second), false)
+	require.NoError(t, err)
+	assert.True(t, reply.ConnectionRefused)
+	assert.Equal(t, uint16(3), reply.SequenceNumber)
+	assert.True(t, reply.Source.Equal(target.destIP))
+	assert.GreaterOrEqual(t, reply.rtt(sentAt), time.Duration(0))
+}
@@ -0,0 +1,166 @@
+package ping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/swagnikdutta/netprobe/pkg/dialer"
+)
+
+// udpProber sends UDP datagrams to a port of the target. Any UDP response, as
+// well as an ICMP Port Unreachable error sent by the target, proves that it is
+// up. It is meant for hosts that filter both ICMP echo requests and TCP.
+type udpProber struct {
+	pinger *Pinger
+	port   int
+	// icmpErrors receives the ICMP error messages caused by our datagrams,
+	// it is nil when they can't be read from a raw socket. The kernel then
+	// reports Port Unreachable errors as ECONNREFUSED, on the UDP socket.
+	icmpErrors *session
+}
+
+// newUDPProber returns a udpProber, which listens for ICMP errors on a raw
+// socket when the process is allowed to open one.
+func (pinger *Pinger) newUDPProber(ctx context.Context, ipv6 bool) (prober, func(), error) {
+	p := &udpProber{pinger: pinger, port: pinger.port}
+	if !pinger.privileged {
+		return p, func() {}, nil
+	}
+
+	s, err := pinger.newSession(ipv6)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.icmpErrors = s
+	stop := closeOnCancel(ctx, s.conn)
+	return p, func() {
+		stop()
+		s.Close()
+	}, nil
+}
+
+// probe sends a single datagram, from a socket of its own, to the port of t.
+func (p *udpProber) probe(ctx context.Context, t *target, seq uint16, sentAt, deadline time.Time, verbose bool) (*echoReply, error) {
+	address := net.JoinHostPort(t.destIP.String(), strconv.Itoa(p.port))
+	conn, err := p.pinger.dialer.Dial("udp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening UDP socket")
+	}
+	defer conn.Close()
+
+	if p.pinger.ttl != 0 {
+		if err := dialer.SetTTL(conn, int(p.pinger.ttl)); err != nil {
+			return nil, errors.Wrapf(err, "error setting TTL")
+		}
+	}
+	if p.pinger.tos != 0 {
+		if err := dialer.SetTOS(conn, int(p.pinger.tos)); err != nil {
+			return nil, errors.Wrapf(err, "error setting type of service")
+		}
+	}
+
+	// errors are matched to the datagram they quote by its ports
+	localAddr := conn.LocalAddr().(*net.UDPAddr)
+	var pending *probe
+	icmpResults := make(chan probeResult)
+	if p.icmpErrors != nil {
+		key := probeKey{
+			protocol: UDPProtocolNumber,
+			id:       uint16(localAddr.Port),
+			seq:      uint16(p.port),
+		}
+		pending = p.icmpErrors.expect(t, key, sentAt)
+		defer p.icmpErrors.forget(pending)
+		icmpResults = pending.result
+	}
+
+	payload := p.pinger.createPayload(p.pinger.size, sentAt)
+	if verbose {
+		fmt.Printf("sent UDP datagram (%v bytes) from %v, to %s, seq_no: %v\n", len(payload), localAddr, address, seq)
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return nil, errors.Wrapf(err, "error sending UDP datagram")
+	}
+
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, errors.Wrapf(err, "error setting read deadline")
+	}
+	udpResults := make(chan probeResult, 1)
+	go func() {
+		udpResults <- p.read(conn, t, seq)
+	}()
+
+	var result probeResult
+	select {
+	case result = <-udpResults:
+	case result = <-icmpResults:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if result.err == nil {
+		return result.reply, nil
+	}
+
+	var probeErr *probeError
+	if !errors.As(result.err, &probeErr) {
+		return nil, result.err
+	}
+	m := probeErr.Message
+	if m.IsPortUnreachable() && probeErr.Source.Equal(t.destIP) {
+		return &echoReply{
+			Source:          probeErr.Source,
+			SequenceNumber:  seq,
+			ReceivedAt:      time.Now(),
+			PortUnreachable: true,
+		}, nil
+	}
+	probeErr.SequenceNumber = seq
+	return nil, probeErr
+}
+
+// read waits for the response to the datagram sent on conn, or for the error
+// it caused to be reported on conn.
+func (p *udpProber) read(conn net.Conn, t *target, seq uint16) probeResult {
+	// the largest possible UDP payload
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	receivedAt := time.Now()
+
+	switch {
+	case err == nil:
+		return probeResult{reply: &echoReply{
+			Source:         t.destIP,
+			Size:           n,
+			SequenceNumber: seq,
+			ReceivedAt:     receivedAt,
+		}}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return probeResult{reply: &echoReply{
+			Source:          t.destIP,
+			SequenceNumber:  seq,
+			ReceivedAt:      receivedAt,
+			PortUnreachable: true,
+		}}
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		var errno syscall.Errno
+		errors.As(err, &errno)
+		return probeResult{err: &connectError{Address: conn.RemoteAddr().String(), SequenceNumber: seq, Err: errno}}
+	case isTimeout(err):
+		return probeResult{err: errTimeout}
+	default:
+		return probeResult{err: errors.Wrapf(err, "error receiving UDP response")}
+	}
+}
+
+func (p *udpProber) printReply(reply *echoReply, rtt time.Duration) {
+	if reply.PortUnreachable {
+		fmt.Printf("port %d unreachable from %v, seq no: %v, time: %s ms\n\n", p.port, reply.Source, reply.SequenceNumber, formatMillis(rtt))
+		return
+	}
+	fmt.Printf("received UDP response (%v bytes) from %v port %d, seq no: %v, time: %s ms\n\n", reply.Size, reply.Source, p.port, reply.SequenceNumber, formatMillis(rtt))
+}